@@ -0,0 +1,207 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/kubernetes"
+
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+)
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive",
+	Short: "Query the records kept of deleted labs",
+	Long: `oplmgr archive list
+oplmgr archive show --clusterid b592ec70-487f-44fc-a389-80bbf111ec96
+
+delete and reap write an archive of every lab before deleting it; the ClusterDeployment spec,
+status, labels and annotations, the request data kept in the lab secret and the power and email
+history of the lab. Credentials are never archived.
+
+Archives are gzipped tarballs encrypted with a key derived from the OPL_ARCHIVE_KEY environment
+variable or the archive.key key of the config file. They are written to --archive-dir, the
+archive.dir key of the config file or $HOME/.oplmgr/archive.`,
+}
+
+var archiveListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the archived labs",
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterid, err := cmd.Flags().GetString("clusterid")
+		if err != nil {
+			log.Printf("Unable to get clusterid: %v\n", err)
+		}
+
+		paths, err := ListArchives(archiveDir(cmd), clusterid)
+		if err != nil {
+			log.Fatalf("Unable to list archives: %v\n", err)
+		}
+
+		key := archiveKey()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if _, err = fmt.Fprintln(w, "CLUSTER ID\tCOMPANY\tARCHIVED AT\tREASON\tFILE"); err != nil {
+			log.Fatalf("Unable to print the archives: %v\n", err)
+		}
+		for _, path := range paths {
+			archive, readerr := ReadLabArchive(path, key)
+			if readerr != nil {
+				log.Printf("Unable to read archive: %v\n", readerr)
+				continue
+			}
+
+			if _, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", archive.ClusterID, archive.Company,
+				archive.ArchivedAt.Format(time.RFC3339), archive.Reason, filepath.Base(path)); err != nil {
+				log.Fatalf("Unable to print the archives: %v\n", err)
+			}
+		}
+
+		if err = w.Flush(); err != nil {
+			log.Printf("Unable to print the archives: %v\n", err)
+		}
+	},
+}
+
+var archiveShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the archive of a lab",
+	Long: `oplmgr archive show --clusterid b592ec70-487f-44fc-a389-80bbf111ec96
+oplmgr archive show --file b592ec70-487f-44fc-a389-80bbf111ec96-20211014T090000.000000000Z.tar.gz.enc
+
+Prints the most recent archive of the cluster, or the given archive file, as JSON.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterid, err := cmd.Flags().GetString("clusterid")
+		if err != nil {
+			log.Printf("Unable to get clusterid: %v\n", err)
+		}
+
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			log.Printf("Unable to get the file flag: %v\n", err)
+		}
+
+		dir := archiveDir(cmd)
+
+		switch {
+		case file != "":
+			if _, err = os.Stat(file); os.IsNotExist(err) {
+				file = filepath.Join(dir, file)
+			}
+		case clusterid != "":
+			paths, err := ListArchives(dir, clusterid)
+			if err != nil {
+				log.Fatalf("Unable to list archives: %v\n", err)
+			}
+			if len(paths) == 0 {
+				log.Fatalf("No archive found for cluster %v in %v\n", clusterid, dir)
+			}
+			file = paths[len(paths)-1]
+		default:
+			log.Fatalln("Either --clusterid or --file is required")
+		}
+
+		archive, err := ReadLabArchive(file, archiveKey())
+		if err != nil {
+			log.Fatalf("Unable to read archive: %v\n", err)
+		}
+
+		data, err := json.MarshalIndent(archive, "", "  ")
+		if err != nil {
+			log.Fatalf("Unable to print archive %v: %v\n", file, err)
+		}
+
+		fmt.Println(string(data))
+	},
+}
+
+// archiveLab writes the archive of the lab before it is deleted
+func archiveLab(k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment, dir string, reason string) error {
+	archive, err := NewLabArchive(k8sclient, cd, reason)
+	if err != nil {
+		return err
+	}
+
+	path, err := ArchiveLab(dir, archiveKey(), archive)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Archived cluster %v to %v\n", cd.Name, path)
+
+	return nil
+}
+
+// checkArchiveKey fails before anything is deleted when there is no key to encrypt archives with
+func checkArchiveKey() error {
+	if archiveKey() == "" {
+		return fmt.Errorf("no archive key set; set OPL_ARCHIVE_KEY or the archive.key key of the config file")
+	}
+
+	return nil
+}
+
+// archiveKey returns the passphrase archives are encrypted with
+func archiveKey() string {
+	if key := os.Getenv("OPL_ARCHIVE_KEY"); key != "" {
+		return key
+	}
+
+	return viper.GetString("archive.key")
+}
+
+// archiveDir returns where lab archives are written; the archive-dir flag, the archive.dir key of the
+// config file or ~/.oplmgr/archive
+func archiveDir(cmd *cobra.Command) string {
+	dir, err := cmd.Flags().GetString("archive-dir")
+	if err != nil {
+		log.Printf("Unable to get the archive-dir flag: %v\n", err)
+	}
+
+	if dir == "" {
+		dir = viper.GetString("archive.dir")
+	}
+
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Printf("Unable to get user's home directory: %v\n", err)
+		}
+		dir = filepath.Join(home, ".oplmgr", "archive")
+	}
+
+	return dir
+}
+
+func init() {
+	archiveCmd.PersistentFlags().String("archive-dir", "", "directory the lab archives are kept in (default is $HOME/.oplmgr/archive)")
+	archiveShowCmd.Flags().String("file", "", "archive file to show instead of the latest archive of --clusterid")
+
+	archiveCmd.AddCommand(archiveListCmd)
+	archiveCmd.AddCommand(archiveShowCmd)
+	rootCmd.AddCommand(archiveCmd)
+}
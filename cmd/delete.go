@@ -17,13 +17,20 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package cmd
 
 import (
+	"bufio"
 	"context"
-	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
 	"github.com/spf13/cobra"
-
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	runtimec "sigs.k8s.io/controller-runtime/pkg/client"
 
 	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
 )
@@ -31,7 +38,28 @@ import (
 var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete an existing Hive ClusterDeployment",
-	Long:  ``,
+	Long: `oplmgr delete --clusterid b592ec70-487f-44fc-a389-80bbf111ec96
+oplmgr delete --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --yes --force
+oplmgr delete --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --soft --grace 72h
+
+The details of the cluster are shown and you are asked to confirm before anything is deleted;
+pass --yes to skip the confirmation. Clusters labelled opl-protected=true are never deleted.
+Clusters whose lease has not ended yet are only deleted when --force is passed.
+
+Before anything is deleted the lab is archived, see "oplmgr archive --help"; nothing is deleted
+when the archive cannot be written unless --skip-archive is passed.
+
+Besides the ClusterDeployment, everything provision created for the lab is removed; the
+ClusterImageSet, MachinePools, SyncSets, ConfigMaps and Secrets labelled opl-lab=<clusterid>.
+The cloud credentials Hive needs to deprovision the cluster are kept unless --wait is passed,
+in which case the ClusterDeprovision and its uninstall pod are followed until the cloud
+resources are gone. Credentials kept this way are removed by the next delete or reap once their
+ClusterDeployment is gone.
+
+With --soft nothing is deleted yet. The cluster is hibernated and labelled opl-pending-deletion,
+which keeps it asleep and stops wake, schedule, info and email from giving partners access to it
+again. "oplmgr reap" deletes it once the grace period is over (--grace, or the delete.grace key of
+the config file, 72h by default) and "oplmgr restore" undoes the soft delete until then.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		clusterid, err := cmd.Flags().GetString("clusterid")
 		if err != nil {
@@ -43,22 +71,225 @@ var deleteCmd = &cobra.Command{
 			log.Printf("Unable to get namespace: %v\n", err)
 		}
 
-		client := HiveClientK8sAuthenticate()
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			log.Printf("Unable to get the yes flag: %v\n", err)
+		}
 
-		cdt := &hivev1.ClusterDeployment{
-			ObjectMeta: metav1.ObjectMeta{
-				Namespace: namespace,
-				Name:      clusterid,
-			},
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			log.Printf("Unable to get the force flag: %v\n", err)
+		}
+
+		wait, err := cmd.Flags().GetBool("wait")
+		if err != nil {
+			log.Printf("Unable to get the wait flag: %v\n", err)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			log.Printf("Unable to get the timeout flag: %v\n", err)
+		}
+
+		soft, err := cmd.Flags().GetBool("soft")
+		if err != nil {
+			log.Printf("Unable to get the soft flag: %v\n", err)
 		}
 
-		err = client.Delete(context.Background(), cdt)
+		grace := durationSetting(cmd, "grace", "delete.grace")
+
+		skiparchive, err := cmd.Flags().GetBool("skip-archive")
 		if err != nil {
-			log.Printf("Unable to delete cluster deployment %v: %v\n", cdt.Name, err)
+			log.Printf("Unable to get the skip-archive flag: %v\n", err)
+		}
+
+		if soft && wait {
+			log.Fatalln("--wait cannot be used with --soft as nothing is deprovisioned yet")
+		}
+
+		if _, err = uuid.Parse(clusterid); err != nil {
+			log.Fatalf("A valid clusterid is required: %v\n", err)
+		}
+
+		client := HiveClientK8sAuthenticate()
+
+		cdt := &hivev1.ClusterDeployment{}
+		if err = client.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: clusterid}, cdt); err != nil {
+			log.Fatalf("Unable to get cluster deployment %v: %v\n", clusterid, err)
+		}
+
+		if err = checkDeletable(cdt, force, time.Now()); err != nil {
+			log.Fatalf("Refusing to delete cluster deployment %v: %v\n", clusterid, err)
+		}
+
+		printDeleteSummary(cdt)
+
+		if soft {
+			if deleteat, pending := PendingDeletion(cdt); pending {
+				log.Fatalf("Cluster %v is already pending deletion at %v\n", clusterid, deleteat.Format(time.RFC3339))
+			}
+
+			if !yes && !confirm("Soft delete cluster "+clusterid+" and delete it in "+formatRemaining(grace)+"?") {
+				log.Println("Delete cancelled")
+				return
+			}
+
+			deleteat := SoftDelete(cdt, grace, time.Now())
+			RecordHistory(cdt, DeleteEvent, "soft deleted, due for deletion at "+deleteat.Format(time.RFC3339))
+			if err = client.Update(context.Background(), cdt); err != nil {
+				log.Fatalf("Unable to soft delete cluster deployment %v: %v\n", clusterid, err)
+			}
+
+			log.Printf("Cluster %v is hibernating and will be deleted at %v; use oplmgr restore to undo\n", clusterid, deleteat.Format(time.RFC3339))
+			return
+		}
+
+		if !skiparchive {
+			if err = checkArchiveKey(); err != nil {
+				log.Fatalf("Unable to archive cluster %v, nothing was deleted: %v\n", clusterid, err)
+			}
+		}
+
+		if !yes && !confirm("Delete cluster "+clusterid+"?") {
+			log.Println("Delete cancelled")
+			return
+		}
+
+		k8sclient := K8sAuthenticate()
+
+		// clean up after earlier deletes that did not wait for the deprovision
+		if err = DeleteOrphanedLabSecrets(client, k8sclient, namespace, false); err != nil {
+			log.Printf("Unable to delete the secrets of deleted labs: %v\n", err)
+		}
+
+		if skiparchive {
+			log.Printf("Warning: cluster %v is deleted without an archive\n", clusterid)
+		} else if err = archiveLab(k8sclient, cdt, archiveDir(cmd), "deleted by oplmgr delete"); err != nil {
+			log.Fatalf("Unable to archive cluster %v, nothing was deleted: %v\n", clusterid, err)
+		}
+
+		if err = deleteLab(client, k8sclient, cdt, wait, timeout); err != nil {
+			log.Fatalf("Unable to delete cluster deployment %v: %v\n", cdt.Name, err)
 		}
 	},
 }
 
+// deleteLab deletes the ClusterDeployment and everything labelled as created for the lab. Without
+// wait the secrets Hive needs to deprovision the cluster are left in place for DeleteOrphanedLabSecrets
+// to remove once the ClusterDeployment is gone.
+func deleteLab(hiveclient runtimec.Client, k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment, wait bool, timeout time.Duration) error {
+	if err := hiveclient.Delete(context.Background(), cd); err != nil {
+		return err
+	}
+	log.Printf("Deleted ClusterDeployment %v\n", cd.Name)
+
+	if !wait {
+		return DeleteLabResources(hiveclient, k8sclient, cd.Namespace, cd.Name, DeprovisionSecrets(cd))
+	}
+
+	if err := waitForDeprovision(hiveclient, k8sclient, cd.Namespace, cd.Name, timeout); err != nil {
+		return err
+	}
+
+	return DeleteLabResources(hiveclient, k8sclient, cd.Namespace, cd.Name, nil)
+}
+
+// waitForDeprovision follows the deprovision of the cluster, printing every change in its status,
+// until the ClusterDeployment is gone
+func waitForDeprovision(hiveclient runtimec.Client, k8sclient *kubernetes.Clientset, namespace string, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	last := ""
+
+	for {
+		status, done, err := DeprovisionStatus(hiveclient, k8sclient, namespace, name)
+		if err != nil {
+			log.Printf("Unable to get the deprovision status of cluster %v: %v\n", name, err)
+		} else if status != last {
+			log.Printf("Cluster %v: %v\n", name, status)
+			last = status
+		}
+
+		if done {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v waiting for the cluster to be deprovisioned", timeout)
+		}
+
+		time.Sleep(15 * time.Second)
+	}
+}
+
+// checkDeletable returns why a cluster must not be deleted; protected clusters never are and clusters
+// with time left on their lease only are when forced
+func checkDeletable(cd *hivev1.ClusterDeployment, force bool, now time.Time) error {
+	if cd.Labels[ProtectedLabel] == "true" {
+		return fmt.Errorf("cluster is labelled %v=true", ProtectedLabel)
+	}
+
+	leaseend, ok := LeaseEnd(cd)
+	if !ok || !leaseend.After(now) {
+		return nil
+	}
+
+	if !force {
+		return fmt.Errorf("lease ends at %v; pass --force to delete it anyway", leaseend.Format(time.RFC3339))
+	}
+
+	log.Printf("Warning: the lease of cluster %v ends at %v\n", cd.Name, leaseend.Format(time.RFC3339))
+
+	return nil
+}
+
+func printDeleteSummary(cd *hivev1.ClusterDeployment) {
+	leaseend := "unknown"
+	if end, ok := LeaseEnd(cd); ok {
+		leaseend = end.Format(time.RFC3339)
+	}
+
+	_, err := fmt.Fprintf(os.Stdout, `
+------------------------------------------------
+Cluster ID: %s
+Cluster Name: %s
+Company: %s
+Region: %s
+Cluster State: %s
+Console URL: %s
+Lease End: %s
+------------------------------------------------
+`, cd.Name, cd.Spec.ClusterName, cd.Annotations[CompanyAnnotation], LabRegion(cd),
+		currentPowerState(cd), cd.Status.WebConsoleURL, leaseend)
+
+	if err != nil {
+		log.Printf("Unable to print information on cluster %v: %v\n", cd.Name, err)
+	}
+}
+
+// confirm asks a yes/no question on stdin and only returns true for an explicit yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
 func init() {
+	flags := deleteCmd.Flags()
+	flags.Bool("yes", false, "do not ask for confirmation")
+	flags.Bool("force", false, "delete the cluster even if its lease has not ended")
+	flags.Bool("wait", false, "wait until the cloud resources of the cluster are removed")
+	flags.Duration("timeout", time.Hour, "how long to wait for the cluster to be deprovisioned")
+	flags.Bool("soft", false, "hibernate the cluster and only delete it once the grace period is over")
+	flags.Duration("grace", 72*time.Hour, "how long a soft deleted cluster can still be restored")
+	flags.String("archive-dir", "", "directory the lab archives are kept in (default is $HOME/.oplmgr/archive)")
+	flags.Bool("skip-archive", false, "delete the cluster without archiving it first")
+
 	rootCmd.AddCommand(deleteCmd)
 }
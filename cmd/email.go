@@ -18,15 +18,18 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	hivev1 "github.com/openshift/hive/apis/hive/v1"
 	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
 	"github.com/spf13/cobra"
-	v1 "k8s.io/api/core/v1"
+	"github.com/spf13/viper"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 var welcome bool
@@ -44,16 +47,23 @@ func init() {
 	flags.BoolVar(&credentials, "credentials", false, "send only credentials")
 	flags.BoolVar(&kubeadmin, "kubeadmin", false, "send only kubeadmin password")
 	flags.BoolVar(&kubeconfig, "kubeconfig", false, "send only kubeconfig")
-	flags.StringSliceVar(&to, "to", []string{}, "comma separated list of to addresses")
-	flags.StringSliceVar(&cc, "cc", []string{}, "comma separated list of cc addresses")
+	flags.String("type", "", "type of email to send; welcome, credentials, kubeadmin or kubeconfig")
+	flags.String("templates-dir", "", "directory with email templates overriding the built in ones")
+	flags.Bool("dry-run", false, "print the email instead of sending it; credential links are placeholders")
+	flags.StringP("output", "o", "", "write the email to a .eml or .html file instead of sending it; implies --dry-run")
+	flags.StringSliceVar(&to, "to", []string{}, "comma separated list of to addresses replacing the contacts of the cluster")
+	flags.StringSliceVar(&cc, "cc", []string{}, "comma separated list of cc addresses replacing the sponsor of the cluster")
 	flags.StringSliceVar(&bcc, "bcc", []string{}, "comma separated list of bcc addresses")
+	flags.StringSlice("add-cc", []string{}, "comma separated list of cc addresses added to the sponsor of the cluster")
 
-	flags.String("company", "", "provide company name for email subject line")
+	flags.String("company", "", "provide company name for email subject line (default is the company recorded on the cluster)")
 	flags.String("clusterid", "", "provide clusterid you want to work with")
 
-	emailCmd.MarkFlagRequired("company")
 	emailCmd.MarkFlagRequired("clusterid")
 
+	emailTestCmd.Flags().StringSlice("to", []string{}, "comma separated list of addresses to send a test email to")
+
+	emailCmd.AddCommand(emailTestCmd)
 	rootCmd.AddCommand(emailCmd)
 
 	// Here you will define your flags and configuration settings.
@@ -67,101 +77,428 @@ func init() {
 	// emailCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-func getClusterDeploymentInfo(clusterid string) (consoleurl string, timezone string, kubeadminlink *v1.Secret, kubeconfiglink *v1.Secret) {
+// getClusterDeploymentInfo returns the cluster and those of its credentials the email kind needs
+func getClusterDeploymentInfo(clusterid string, message MessageKind) (*hivev1.ClusterDeployment, map[string]string) {
 	cd := hivev1.ClusterDeployment{}
 
 	hiveclient := HiveClientK8sAuthenticate()
 	err := hiveclient.Get(context.Background(), types.NamespacedName{Namespace: "hive", Name: clusterid}, &cd)
 	if err != nil {
-		log.Printf("Unable to get the cluster with id %v: %v\n", clusterid, err)
+		log.Fatalf("Unable to get the cluster with id %v: %v\n", clusterid, err)
+	}
+
+	if deleteat, pending := PendingDeletion(&cd); pending {
+		log.Fatalf("Cluster %v is pending deletion at %v; no email with access to it is sent\n", clusterid, deleteat.Format(time.RFC3339))
+	}
+
+	credentials := map[string]string{}
+	if !message.Needs("kubeadmin") && !message.Needs("kubeconfig") {
+		return &cd, credentials
+	}
+
+	if cd.Spec.ClusterMetadata == nil {
+		log.Fatalf("Cluster %v has no credentials yet; is it still installing?\n", clusterid)
 	}
 
 	k8sclient := K8sAuthenticate()
-	kubeadminsecret, err := k8sclient.CoreV1().Secrets("hive").Get(context.Background(), cd.Spec.ClusterMetadata.AdminPasswordSecretRef.Name, metav1.GetOptions{})
-	if err != nil {
-		log.Printf("Unable to get the cluster kubeadmin secret: %v\n", err)
+	if message.Needs("kubeadmin") {
+		kubeadminsecret, err := k8sclient.CoreV1().Secrets("hive").Get(context.Background(), cd.Spec.ClusterMetadata.AdminPasswordSecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Printf("Unable to get the cluster kubeadmin secret: %v\n", err)
+		} else {
+			credentials["kubeadmin"] = string(kubeadminsecret.Data["password"])
+		}
 	}
 
-	kubeconfigsecret, err := k8sclient.CoreV1().Secrets("hive").Get(context.Background(), cd.Spec.ClusterMetadata.AdminKubeconfigSecretRef.Name, metav1.GetOptions{})
-	if err != nil {
-		log.Printf("Unable to get the cluster kubeconfig secret: %v\n", err)
+	if message.Needs("kubeconfig") {
+		kubeconfigsecret, err := k8sclient.CoreV1().Secrets("hive").Get(context.Background(), cd.Spec.ClusterMetadata.AdminKubeconfigSecretRef.Name, metav1.GetOptions{})
+		if err != nil {
+			log.Printf("Unable to get the cluster kubeconfig secret: %v\n", err)
+		} else {
+			credentials["kubeconfig"] = string(kubeconfigsecret.Data["raw-kubeconfig"])
+		}
 	}
 
-	return cd.Status.WebConsoleURL, cd.ObjectMeta.Labels["timezone"], kubeadminsecret, kubeconfigsecret
+	return &cd, credentials
+}
+
+// messageRecipients returns every address an email went to
+func messageRecipients(message *Message) []string {
+	return append(append(append([]string{}, message.To...), message.Cc...), message.Bcc...)
+}
+
+// recordEmail adds a sent email to the history of the cluster
+func recordEmail(clusterid string, kind string, recipients []string) {
+	cdt := types.NamespacedName{Namespace: "hive", Name: clusterid}
+	if err := recordEvent(HiveClientK8sAuthenticate(), cdt, EmailEvent, kind+" email sent to "+strings.Join(recipients, ",")); err != nil {
+		log.Printf("Unable to record the email in the history of cluster %v: %v\n", clusterid, err)
+	}
 }
 
 // emailCmd represents the email command
 var emailCmd = &cobra.Command{
 	Use:   "email",
 	Short: "Send email to contacts of cluster",
-	Long: `oplmgr email --welcome --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --company "Red Hat" --to a@a.com,b@a.com --cc c@a.com,d@a.com --bcc e@a.com
-oplmgr email --credentials --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --company "Red Hat" --to a@a.com,b@a.com --cc c@a.com,d@a.com --bcc e@a.com
-oplmgr email --kubeadmin --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --company "Red Hat" --to a@a.com,b@a.com --cc c@a.com,d@a.com --bcc e@a.com
-oplmgr email --kubeconfig --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --company "Red Hat" --to a@a.com,b@a.com --cc c@a.com,d@a.com --bcc e@a.com
+	Long: `oplmgr email --type welcome --clusterid b592ec70-487f-44fc-a389-80bbf111ec96
+oplmgr email --type credentials --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --add-cc c@a.com
+oplmgr email --type kubeadmin --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --to a@a.com,b@a.com --bcc e@a.com
+oplmgr email --type kubeconfig --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --company "Red Hat" --cc c@a.com,d@a.com
 
-This command will silently fail on multiple occassions. You must provide a type as listed below and in the examples,
-clusterid, company, and one of --to --cc or --bcc for this command to work properly. You will not get an error in most
-cases so provide all appropriate and required flags to succeed.
+You must provide a type and the clusterid. The email goes to the primary and secondary contact
+recorded on the cluster when it was provisioned, with the Red Hat sponsor in cc. Labs provisioned
+before contacts were recorded on the cluster fall back to the contacts in their lab secret.
+--to replaces the contacts, --cc replaces the sponsor and --add-cc adds to the sponsor. The
+company defaults to the one recorded on the cluster. The email is not sent and the command fails
+when anything the type of email needs is missing. An email the SMTP server does not take is kept
+in the outbox to be retried by "oplmgr email flush".
 
-Send various types of email to contacts listed on the cluster. You will not be
-able to set or see the email addresses through this command as it only takes the cluster-id
-and the email type you want to send:
+Send various types of email to contacts listed on the cluster:
 
 welcome - provides the initial welcome email after cluster has been successfully provisioned.
 credentials - sends the kubeadmin password and kubeconfig to contacts via privatebin links.
 kubeadmin - send only the kubeadmin password via privatebin link.
 kubeconfig - send only the kubeconfig via privatebin link.
 
-If you pass more than one type of email flag the first will get created and sent only in the order
-listed above; welcome, credentials, kubeadmin, kubeconfig.`,
+The hibernation and deletion warnings and the deletion notice are sent by schedule and reap.
+
+Privatebin links are only created for the types that include credentials, and only once the
+recipients and everything else the email needs are known to be there.
+
+--dry-run renders the email with the data of the cluster and prints its headers and text body
+without sending it. Placeholders stand in for the privatebin links, so no credentials are shared.
+--output message.eml writes the whole email, which most mail clients open, and --output
+message.html writes the html body to review in a browser.
+
+--welcome, --credentials, --kubeadmin and --kubeconfig still work as shorthands for --type; when
+more than one is passed the first in the order above is sent.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		clusterid, err := cmd.Flags().GetString("clusterid")
-		octet := strings.Split(clusterid, "-")[0]
+		if err != nil {
+			log.Printf("Unable to get clusterid: %v\n", err)
+		}
+
 		company, err := cmd.Flags().GetString("company")
-		consoleurl, timezone, kubeadminsecret, kubeconfigsecret := getClusterDeploymentInfo(clusterid)
-		clusterinfo := GenerateMultiplePastes(os.Getenv("PRIVATEBIN_HOST"),
-			map[string]string{
-				"kubeadmin":  string(kubeadminsecret.Data["password"]),
-				"kubeconfig": string(kubeconfigsecret.Data["raw-kubeconfig"]),
-			})
-		clusterinfo["consoleurl"] = consoleurl
-		clusterinfo["clusterid"] = octet
+		if err != nil {
+			log.Printf("Unable to get company: %v\n", err)
+		}
+
+		kind, err := cmd.Flags().GetString("type")
+		if err != nil {
+			log.Printf("Unable to get the type flag: %v\n", err)
+		}
+
+		if kind == "" {
+			kind = emailShorthand()
+		}
+		if kind == "" {
+			log.Fatalln("No email type given; pass --type")
+		}
+
+		mailer, err := newMailer(cmd)
+		if err != nil {
+			log.Fatalf("Unable to set up email: %v\n", err)
+		}
+		mailer.Outbox = outboxDir(cmd)
+
+		message, ok := mailer.Kind(kind)
+		if !ok {
+			log.Fatalf("Unknown email type %v; use one of %v\n", kind, strings.Join(mailer.Kinds(), ", "))
+		}
+
+		addcc, err := cmd.Flags().GetStringSlice("add-cc")
+		if err != nil {
+			log.Printf("Unable to get the add-cc flag: %v\n", err)
+		}
+
+		dryrun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Printf("Unable to get the dry-run flag: %v\n", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Printf("Unable to get the output flag: %v\n", err)
+		}
+		if output != "" {
+			dryrun = true
+		}
+
+		cd, pastes := getClusterDeploymentInfo(clusterid, message)
+
+		if company == "" {
+			company = cd.Annotations[CompanyAnnotation]
+		}
+
+		recipientsto, recipientscc := emailRecipients(cmd, cd, addcc)
+
+		clusterinfo := map[string]string{}
+		for key, value := range pastes {
+			if value != "" {
+				clusterinfo[key] = placeholderLink(key)
+			}
+		}
+		clusterinfo["consoleurl"] = cd.Status.WebConsoleURL
+		clusterinfo["clusterid"] = strings.Split(clusterid, "-")[0]
 		clusterinfo["company"] = company
-		clusterinfo["timezone"] = timezone
+		clusterinfo["sponsor"] = cd.Annotations[SponsorAnnotation]
+		clusterinfo["timezone"] = cd.Labels["timezone"]
+		clusterinfo = linkInfo(clusterinfo, hubLinks(), clusterid)
 
-		sendwelcome, err := cmd.Flags().GetBool("welcome")
+		// check the email can be sent before any credentials are shared through privatebin
+		if err = mailer.Validate(kind, recipientsto, recipientscc, bcc, clusterinfo); err != nil {
+			log.Fatalf("Unable to send %v email for cluster %v: %v\n", kind, clusterid, err)
+		}
+
+		if !dryrun && len(pastes) > 0 {
+			for key, link := range GenerateMultiplePastes(os.Getenv("PRIVATEBIN_HOST"), pastes) {
+				clusterinfo[key] = link
+			}
+		}
+
+		rendered, err := mailer.Render(kind, recipientsto, recipientscc, bcc, clusterinfo)
 		if err != nil {
-			log.Printf("Error trying to get welcome flag: %v\n", err)
+			log.Fatalf("Unable to render %v email for cluster %v: %v\n", kind, clusterid, err)
 		}
 
-		sendcreds, err := cmd.Flags().GetBool("credentials")
+		if dryrun {
+			if output == "" {
+				printMessage(mailer, rendered)
+				return
+			}
+
+			if err = writeMessage(mailer, rendered, output); err != nil {
+				log.Fatalf("Unable to write %v email for cluster %v: %v\n", kind, clusterid, err)
+			}
+			log.Printf("%v email written to %v; nothing was sent.\n", kind, output)
+			return
+		}
+
+		if entry, err := mailer.SendOrQueue(rendered, clusterid, true); entry != nil {
+			log.Printf("Unable to send %v email for cluster %v: %v\n", kind, clusterid, err)
+			log.Fatalf("The email is queued as %v; oplmgr email flush retries it\n", entry.ID)
+		} else if err != nil {
+			log.Fatalf("Unable to send %v email for cluster %v: %v\n", kind, clusterid, err)
+		}
+
+		log.Printf("%v email sent successfully.\n", kind)
+		recordEmail(clusterid, kind, messageRecipients(rendered))
+	},
+}
+
+// emailRecipients returns the to and cc addresses of an email about the cluster; --to and --cc replace
+// the contacts recorded on the cluster and --add-cc is added to whichever cc list is used
+func emailRecipients(cmd *cobra.Command, cd *hivev1.ClusterDeployment, addcc []string) ([]string, []string) {
+	recipientsto, recipientscc := to, cc
+
+	if !cmd.Flags().Changed("to") || !cmd.Flags().Changed("cc") {
+		contacts, err := LabContacts(K8sAuthenticate(), cd)
 		if err != nil {
-			log.Printf("Error trying to get credentials flag: %v\n", err)
+			log.Printf("Unable to get the contacts of cluster %v: %v\n", cd.Name, err)
+		}
+
+		if !cmd.Flags().Changed("to") {
+			recipientsto = contacts.To()
+		}
+		if !cmd.Flags().Changed("cc") {
+			recipientscc = contacts.Cc()
 		}
+	}
 
-		sendadmin, err := cmd.Flags().GetBool("kubeadmin")
+	for _, address := range addcc {
+		if !Contains(recipientscc, address) {
+			recipientscc = append(recipientscc, address)
+		}
+	}
+
+	return recipientsto, recipientscc
+}
+
+// placeholderLink stands in for a privatebin link in an email that is not sent
+func placeholderLink(key string) string {
+	host := strings.TrimSuffix(os.Getenv("PRIVATEBIN_HOST"), "/")
+	if host == "" {
+		host = "https://privatebin.example.com"
+	}
+
+	return host + "/?" + key + "-link-created-when-sent"
+}
+
+// printMessage prints the headers and the text body of an email that is not sent
+func printMessage(mailer *Mailer, message *Message) {
+	fmt.Printf("From: %v\n", mailer.From)
+	fmt.Printf("To: %v\n", strings.Join(message.To, ", "))
+	if len(message.Cc) > 0 {
+		fmt.Printf("Cc: %v\n", strings.Join(message.Cc, ", "))
+	}
+	if len(message.Bcc) > 0 {
+		fmt.Printf("Bcc: %v\n", strings.Join(message.Bcc, ", "))
+	}
+	fmt.Printf("Subject: %v\n\n%v", message.Subject, message.Text)
+}
+
+// writeMessage saves an email that is not sent; a .eml file holds the whole email and a .html file
+// only its html body
+func writeMessage(mailer *Mailer, message *Message, path string) error {
+	var content string
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".eml":
+		mime, err := mailer.MIME(message)
 		if err != nil {
-			log.Printf("error trying to get kubeadmin flag: %v\n", err)
+			return err
 		}
+		content = mime
+	case ".html", ".htm":
+		content = message.HTML
+	default:
+		return fmt.Errorf("unable to tell the format of %v; use a .eml or .html file", path)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("unable to write %v: %w", path, err)
+	}
+
+	return nil
+}
 
-		sendconfig, err := cmd.Flags().GetBool("kubeconfig")
+var emailTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Check the SMTP settings by connecting to the server",
+	Long: `oplmgr email test
+oplmgr email test --to a@a.com
+
+Connects and authenticates to the SMTP server with the settings emails are sent with and reports
+them. With --to a short test email is sent as well.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		testto, err := cmd.Flags().GetStringSlice("to")
+		if err != nil {
+			log.Printf("Unable to get the to flag: %v\n", err)
+		}
+
+		mailer, err := smtpMailer()
 		if err != nil {
-			log.Printf("Error trying to get kubeconfig flag: %v\n", err)
-		}
-
-		switch {
-		case sendwelcome:
-			SendWelcomeEmail(&to, &cc, &bcc, clusterinfo)
-			break
-		case sendcreds:
-			SendCredsEmail(&to, &cc, &bcc, clusterinfo)
-			break
-		case sendadmin:
-			SendAdminEmail(&to, &cc, &bcc, clusterinfo)
-			break
-		case sendconfig:
-			SendConfigEmail(&to, &cc, &bcc, clusterinfo)
-			break
+			log.Fatalf("Unable to set up email: %v\n", err)
 		}
+
+		auth := mailer.Auth
+		if mailer.Username == "" {
+			auth = AuthNone
+		} else if mailer.Auth != AuthNone {
+			auth += " as " + mailer.Username
+		}
+		fmt.Printf("Server:     %v:%v\n", mailer.Host, mailer.SMTPPort())
+		fmt.Printf("Encryption: %v\n", mailer.Encryption)
+		fmt.Printf("Auth:       %v\n", auth)
+		fmt.Printf("From:       %v\n", mailer.From)
+		if mailer.ReplyTo != "" {
+			fmt.Printf("Reply-To:   %v\n", mailer.ReplyTo)
+		}
+
+		client, err := mailer.Connect()
+		if err != nil {
+			log.Fatalf("Unable to reach the SMTP server: %v\n", err)
+		}
+		if err = client.Quit(); err != nil {
+			log.Printf("Unable to close the connection to the SMTP server: %v\n", err)
+		}
+		fmt.Println("Connected successfully.")
+
+		if len(testto) == 0 {
+			return
+		}
+
+		text := "This is a test email sent by oplmgr email test to check its SMTP settings.\n"
+		message := &Message{Kind: "test", To: testto, Subject: "oplmgr test email", Text: text, HTML: "<p>" + text + "</p>"}
+		if err = mailer.SendMessage(message); err != nil {
+			log.Fatalf("Unable to send the test email: %v\n", err)
+		}
+		fmt.Printf("Test email sent to %v.\n", strings.Join(testto, ","))
 	},
 }
+
+// newMailer returns a Mailer using the templates in --templates-dir, or the email.templates-dir key of
+// the config file, with the extra kinds of email listed under email.kinds registered
+func newMailer(cmd *cobra.Command) (*Mailer, error) {
+	mailer, err := smtpMailer()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := cmd.Flags().GetString("templates-dir")
+	if err != nil {
+		log.Printf("Unable to get the templates-dir flag: %v\n", err)
+	}
+	if dir == "" {
+		dir = viper.GetString("email.templates-dir")
+	}
+
+	if dir != "" {
+		if err = mailer.LoadTemplates(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	var kinds []MessageKind
+	if err = viper.UnmarshalKey("email.kinds", &kinds); err != nil {
+		return nil, fmt.Errorf("unable to read email.kinds: %w", err)
+	}
+
+	for _, kind := range kinds {
+		if err = mailer.Register(kind); err != nil {
+			return nil, err
+		}
+	}
+
+	// check the kinds of the config file against the company and sponsor overlays as well
+	if dir != "" && len(kinds) > 0 {
+		if err = mailer.LoadTemplates(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return mailer, nil
+}
+
+// smtpMailer returns a Mailer with the SMTP settings of the environment and config file, for commands
+// that send emails rendered before
+func smtpMailer() (*Mailer, error) {
+	mailer, err := NewMailer()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = configureSMTP(mailer); err != nil {
+		return nil, err
+	}
+
+	return mailer, nil
+}
+
+// configureSMTP applies the keys under smtp of the config file, e.g. smtp.port, to the settings that
+// are not set by their SMTP_* environment variable
+func configureSMTP(mailer *Mailer) error {
+	settings := map[string]string{}
+	for name, variable := range SMTPSettings {
+		if os.Getenv(variable) == "" && viper.IsSet("smtp."+name) {
+			settings[name] = viper.GetString("smtp." + name)
+		}
+	}
+
+	return mailer.Configure(settings)
+}
+
+// emailShorthand returns the type of email selected with the boolean flags predating --type
+func emailShorthand() string {
+	switch {
+	case welcome:
+		return "welcome"
+	case credentials:
+		return "credentials"
+	case kubeadmin:
+		return "kubeadmin"
+	case kubeconfig:
+		return "kubeconfig"
+	}
+
+	return ""
+}
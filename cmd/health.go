@@ -0,0 +1,142 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+)
+
+var healthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check the health of a partner cluster from the inside",
+	Long: `oplmgr health --clusterid b592ec70-487f-44fc-a389-80bbf111ec96
+oplmgr health --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 -o json
+
+Connects to the cluster with the admin kubeconfig Hive stored on the hub and reports the cluster
+version and whether it is still progressing, the nodes that are not ready, the cluster operators
+that are degraded or unavailable and the certificate signing requests waiting for approval. It ends
+with a verdict; Healthy, Progressing, Degraded, Unhealthy, Unreachable or Skipped for clusters that
+are hibernating or not installed. The exit status is 1 unless the cluster is Healthy, so it can be
+used to confirm a lab works after waking it up and before partners log in.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterid, err := cmd.Flags().GetString("clusterid")
+		if err != nil {
+			log.Printf("Unable to get clusterid: %v\n", err)
+		}
+
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			log.Printf("Unable to get namespace: %v\n", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Printf("Unable to get the output flag: %v\n", err)
+		}
+
+		if clusterid == "" {
+			log.Fatalln("--clusterid is required")
+		}
+
+		hiveclient := HiveClientK8sAuthenticate()
+		k8sclient := K8sAuthenticate()
+
+		cd := &hivev1.ClusterDeployment{}
+		if err = hiveclient.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: clusterid}, cd); err != nil {
+			log.Fatalf("Unable to get cluster deployment: %v\n", err)
+		}
+
+		report := CheckHealth(context.Background(), k8sclient, cd)
+
+		if output == "json" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				log.Fatalf("Unable to marshal health report: %v\n", err)
+			}
+			fmt.Println(string(data))
+		} else if err = printHealth(os.Stdout, report); err != nil {
+			log.Printf("Unable to print health report: %v\n", err)
+		}
+
+		if report.Verdict != HealthHealthy {
+			os.Exit(1)
+		}
+	},
+}
+
+// printHealth writes the findings of the health probe followed by the verdict
+func printHealth(out io.Writer, report HealthReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Cluster:\t%s\n", report.ClusterID)
+	if report.Verdict != HealthSkipped && report.Error == "" {
+		version := dash(report.Version)
+		if report.VersionProgressing {
+			version += " (progressing: " + report.VersionMessage + ")"
+		}
+		fmt.Fprintf(w, "Version:\t%s\n", version)
+		fmt.Fprintf(w, "Nodes ready:\t%d/%d\n", report.ReadyNodes, report.Nodes)
+		fmt.Fprintf(w, "Nodes not ready:\t%s\n", dash(strings.Join(report.NotReadyNodes, ", ")))
+		fmt.Fprintf(w, "Degraded operators:\t%s\n", dash(strings.Join(report.DegradedOperators, ", ")))
+		fmt.Fprintf(w, "Unavailable operators:\t%s\n", dash(strings.Join(report.UnavailableOperators, ", ")))
+		fmt.Fprintf(w, "Pending CSRs:\t%d\n", len(report.PendingCSRs))
+	}
+	if report.Error != "" {
+		fmt.Fprintf(w, "Error:\t%s\n", report.Error)
+	}
+	fmt.Fprintf(w, "Verdict:\t%s\n", report.Verdict)
+	for _, reason := range report.Reasons {
+		fmt.Fprintf(w, "\t- %s\n", reason)
+	}
+
+	return w.Flush()
+}
+
+// healthVerdict is the HEALTH cell of info; the verdict followed by the first reason for it
+func healthVerdict(report *HealthReport) string {
+	if report == nil {
+		return ""
+	}
+
+	switch {
+	case report.Error != "":
+		return report.Verdict + " (" + report.Error + ")"
+	case report.Verdict != HealthHealthy && len(report.Reasons) > 0:
+		return report.Verdict + " (" + report.Reasons[0] + ")"
+	}
+
+	return report.Verdict
+}
+
+func init() {
+	healthCmd.Flags().StringP("output", "o", "text", "output format; text or json")
+
+	rootCmd.AddCommand(healthCmd)
+}
@@ -18,179 +18,632 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
 	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"github.com/openshift/hive/pkg/constants"
 	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
 	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
-	"log"
-	"os"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
 )
 
 // infoCmd represents the info command
 var infoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "Get information about cluster(s)",
-	Long:  ``,
+	Long: `oplmgr info
+oplmgr info --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 -o json
+oplmgr info -o wide
+
+Prints a summary of every cluster, or of a single one with --clusterid. The output is an aligned
+table by default; -o wide adds the company, region, platform, age, lease end and last error of
+each cluster and -o json or -o yaml print the full summaries for scripts.
+
+Besides the power state, the summary shows whether the cluster is installed, the stage and attempt
+of its current ClusterProvision while it is installing, and every condition of the ClusterDeployment
+or ClusterProvision reporting a problem, e.g. DNSNotReady, ProvisionFailed or Unreachable.
+
+No credentials are shown by default. --show-secret-refs adds the names of the secrets holding the
+kubeadmin password and kubeconfig. --with-credentials shares them through one-time PrivateBin
+links; it only works together with --clusterid and asks for confirmation unless --yes is passed.
+
+Clusters are looked up by --concurrency workers sharing a limit of --qps calls per second to the
+hub, which keeps listing a large hub fast without flooding its API server. Secrets are listed once
+up front; one missing from that list, e.g. because it lacks Hive's labels, is fetched on its own and
+counts as a call. The calls --health makes to the partner clusters themselves are not limited.
+
+The clusters can be filtered with --company, --sponsor, --region, --state, --expiring-within and
+any label selector passed with -l, and ordered with --sort-by:
+
+oplmgr info --region emea --state hibernating
+oplmgr info --expiring-within 72h --sort-by lease-end -o wide
+oplmgr info -l opl-lease-time=one-month --company "Red Hat"
+
+With --watch the clusters are watched and a compact table of their company, region, power state,
+install status and age is redrawn whenever one of them changes; rows that changed in the last two
+minutes are highlighted. When the output is not a terminal every change is printed as a line
+instead, which suits logging a workshop morning to a file. The filters above apply to --watch too;
+-o, --health, --with-credentials and --show-secret-refs can't be combined with it.
+
+--health looks inside every running cluster with its admin kubeconfig, like oplmgr health does, and
+adds the verdict to the table.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		clusterid, err := cmd.Flags().GetString("clusterid")
 		if err != nil {
 			log.Printf("Unable to get the clusterid flag: %v\n", err)
 		}
 
-		cds := make(map[string]interface{})
-		cd := make(map[string]interface{})
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			log.Printf("Unable to get namespace: %v\n", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			log.Printf("Unable to get the output flag: %v\n", err)
+		}
 
-		if clusterid == "" {
-			cds = getClusterDeployments("")
-			for name, info := range cds {
-				if info.(map[string]interface{})["cluster"].(hivev1.ClusterDeployment).Spec.PowerState != "Hibernating" {
-					info.(map[string]interface{})["powerstate"] = "Running"
-				}
+		if !Contains([]string{"table", "wide", "json", "yaml"}, output) {
+			log.Fatalf("Unknown output format %v; use one of table, wide, json or yaml\n", output)
+		}
+
+		withcredentials, err := cmd.Flags().GetBool("with-credentials")
+		if err != nil {
+			log.Printf("Unable to get the with-credentials flag: %v\n", err)
+		}
+
+		showrefs, err := cmd.Flags().GetBool("show-secret-refs")
+		if err != nil {
+			log.Printf("Unable to get the show-secret-refs flag: %v\n", err)
+		}
+
+		yes, err := cmd.Flags().GetBool("yes")
+		if err != nil {
+			log.Printf("Unable to get the yes flag: %v\n", err)
+		}
+
+		watch, err := cmd.Flags().GetBool("watch")
+		if err != nil {
+			log.Printf("Unable to get the watch flag: %v\n", err)
+		}
 
-				_, err = fmt.Fprintf(os.Stdout, `
-------------------------------------------------
-Cluster ID: %s
-Request URL: %s
-Cluster State: %s
-Console URL: %s
-Credentials:
-  kubeadmin: %s
-  kubeconfig: %s
-------------------------------------------------
-`, info.(map[string]interface{})["cluster"].(hivev1.ClusterDeployment).Name, "https://ui.apps.eng.partner-lab.rhecoeng.com/request/"+name,
-					info.(map[string]interface{})["powerstate"],
-					info.(map[string]interface{})["consoleurl"],
-					info.(map[string]interface{})["credentials"].(map[string]string)["kubeadmin"],
-					info.(map[string]interface{})["credentials"].(map[string]string)["kubeconfig"])
-
-				if err != nil {
-					log.Printf("Unable to print information on cluster %v: %v\n", name, err)
+		// the live table has fixed columns and never looks inside the clusters
+		if watch {
+			for _, flag := range []string{"output", "health", "with-credentials", "show-secret-refs"} {
+				if cmd.Flags().Changed(flag) {
+					log.Fatalf("--%v can't be used together with --watch\n", flag)
 				}
 			}
-		} else {
-			cd = getClusterDeployments(clusterid)
+		}
 
-			if cd["cluster"].(hivev1.ClusterDeployment).Spec.PowerState != "Hibernating" {
-				cd["powerstate"] = "Running"
+		if withcredentials {
+			if clusterid == "" {
+				log.Fatalln("--with-credentials needs --clusterid; credential links are only created for a single cluster")
+			}
+			if !yes && !confirm("Create one-time credential links for cluster "+clusterid+"?") {
+				withcredentials = false
 			}
+		}
+
+		concurrency, err := cmd.Flags().GetInt("concurrency")
+		if err != nil {
+			log.Printf("Unable to get the concurrency flag: %v\n", err)
+		}
+
+		qps, err := cmd.Flags().GetFloat64("qps")
+		if err != nil {
+			log.Printf("Unable to get the qps flag: %v\n", err)
+		}
 
-			_, err = fmt.Fprintf(os.Stdout, `
-------------------------------------------------
-Cluster ID: %s
-Request URL: %s
-Cluster State: %s
-Console URL: %s
-Credentials:
-  kubeadmin: %s
-  kubeconfig: %s
-------------------------------------------------
-`, cd["cluster"].(hivev1.ClusterDeployment).Name, "https://ui.apps.eng.partner-lab.rhecoeng.com/request/"+clusterid,
-				cd["powerstate"],
-				cd["consoleurl"],
-				cd["credentials"].(map[string]string)["kubeadmin"],
-				cd["credentials"].(map[string]string)["kubeconfig"])
+		if qps <= 0 {
+			log.Fatalf("Invalid qps %v; it must be greater than 0\n", qps)
+		}
 
-			if err != nil {
-				log.Printf("Unable to print information on cluster %v: %v\n", clusterid, err)
+		opts := infoOptions{
+			WithCredentials: withcredentials,
+			ShowSecretRefs:  showrefs,
+			Concurrency:     concurrency,
+			QPS:             qps,
+			Links:           hubLinks(),
+		}
+
+		if opts.Selector, err = cmd.Flags().GetString("selector"); err != nil {
+			log.Printf("Unable to get the selector flag: %v\n", err)
+		}
+
+		if opts.Region, err = cmd.Flags().GetString("region"); err != nil {
+			log.Printf("Unable to get the region flag: %v\n", err)
+		}
+
+		if opts.Sponsor, err = cmd.Flags().GetString("sponsor"); err != nil {
+			log.Printf("Unable to get the sponsor flag: %v\n", err)
+		}
+
+		if opts.State, err = cmd.Flags().GetString("state"); err != nil {
+			log.Printf("Unable to get the state flag: %v\n", err)
+		}
+
+		if opts.ExpiringWithin, err = cmd.Flags().GetDuration("expiring-within"); err != nil {
+			log.Printf("Unable to get the expiring-within flag: %v\n", err)
+		}
+
+		if opts.SortBy, err = cmd.Flags().GetString("sort-by"); err != nil {
+			log.Printf("Unable to get the sort-by flag: %v\n", err)
+		}
+
+		// --company is a persistent flag with a default; only filter on it when it was given
+		if cmd.Flags().Changed("company") {
+			if opts.Company, err = cmd.Flags().GetString("company"); err != nil {
+				log.Printf("Unable to get the company flag: %v\n", err)
+			}
+		}
+
+		if opts.State != "" && !Contains(infoStates, opts.State) {
+			log.Fatalf("Unknown state %v; use one of %v\n", opts.State, strings.Join(infoStates, ", "))
+		}
+
+		if !Contains(infoSortKeys, opts.SortBy) {
+			log.Fatalf("Unknown sort key %v; use one of %v\n", opts.SortBy, strings.Join(infoSortKeys, ", "))
+		}
+
+		if opts.Health, err = cmd.Flags().GetBool("health"); err != nil {
+			log.Printf("Unable to get the health flag: %v\n", err)
+		}
+
+		if watch {
+			if err = watchClusters(namespace, clusterid, opts); err != nil {
+				log.Fatalf("Unable to watch clusters: %v\n", err)
 			}
+			return
+		}
+
+		summaries, err := clusterSummaries(namespace, clusterid, opts)
+		if err != nil {
+			log.Fatalf("Unable to get information on clusters: %v\n", err)
+		}
+
+		if err = printSummaries(os.Stdout, summaries, output); err != nil {
+			log.Printf("Unable to print information on clusters: %v\n", err)
 		}
 	},
 }
 
-func getClusterDeployments(clusterid string) map[string]interface{} {
+// infoOptions controls what clusterSummaries looks up for every cluster
+type infoOptions struct {
+	WithCredentials bool
+	ShowSecretRefs  bool
+	Health          bool
+	Concurrency     int
+	QPS             float64
+	Selector        string
+	Region          string
+	Company         string
+	Sponsor         string
+	State           string
+	ExpiringWithin  time.Duration
+	SortBy          string
+	Links           Links
+}
+
+// infoStates are the values --state accepts
+var infoStates = []string{"hibernating", "running", "installing", "failed"}
+
+// infoSortKeys are the values --sort-by accepts
+var infoSortKeys = []string{"id", "age", "company", "lease-end"}
+
+// clusterSummaries returns the summary of a single cluster, or of every cluster in the namespace
+// when clusterid is empty, ordered by cluster id. Clusters are summarised by a pool of workers that
+// share a rate limit on the calls they make; errors are reported on the summary of each cluster.
+func clusterSummaries(namespace string, clusterid string, opts infoOptions) ([]ClusterSummary, error) {
+	ctx := context.Background()
 	hiveclient := HiveClientK8sAuthenticate()
+	k8sclient := K8sAuthenticate()
+
+	var cds []hivev1.ClusterDeployment
 
 	if clusterid != "" {
 		cd := hivev1.ClusterDeployment{}
-
-		err := hiveclient.Get(context.Background(), types.NamespacedName{Namespace: "hive", Name: clusterid}, &cd)
+		if err := hiveclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: clusterid}, &cd); err != nil {
+			return nil, fmt.Errorf("unable to get the cluster with id %v: %w", clusterid, err)
+		}
+		cds = append(cds, cd)
+	} else {
+		selector, err := infoSelector(opts)
 		if err != nil {
-			log.Printf("Unable to get the cluster with id %v: %v\n", clusterid, err)
+			return nil, err
 		}
 
-		k8sclient := K8sAuthenticate()
-		kubeadminsecret, err := k8sclient.CoreV1().Secrets("hive").Get(context.Background(), cd.Spec.ClusterMetadata.AdminPasswordSecretRef.Name, metav1.GetOptions{})
-		if err != nil {
-			log.Printf("Unable to get the cluster kubeadmin secret: %v\n", err)
+		list := hivev1.ClusterDeploymentList{}
+		if err = hiveclient.List(ctx, &list, &client.ListOptions{Namespace: namespace, LabelSelector: selector}); err != nil {
+			return nil, fmt.Errorf("unable to get the cluster deployments from namespace %v: %w", namespace, err)
 		}
+		cds = list.Items
+	}
 
-		kubeconfigsecret, err := k8sclient.CoreV1().Secrets("hive").Get(context.Background(), cd.Spec.ClusterMetadata.AdminKubeconfigSecretRef.Name, metav1.GetOptions{})
-		if err != nil {
-			log.Printf("Unable to get the cluster kubeconfig secret: %v\n", err)
+	// filters that cannot be expressed as label selectors are applied before anything else is looked up
+	now := time.Now()
+	matching := cds[:0]
+	for i := range cds {
+		if matchesInfoFilters(&cds[i], opts, now) {
+			matching = append(matching, cds[i])
 		}
+	}
+	cds = matching
 
-		clusterinfo := make(map[string]interface{})
+	sort.Slice(cds, func(i, j int) bool { return cds[i].Name < cds[j].Name })
 
-		clusterinfo["credentials"] = GenerateMultiplePastes(os.Getenv("PRIVATEBIN_HOST"),
-			map[string]string{
-				"kubeadmin":  string(kubeadminsecret.Data["password"]),
-				"kubeconfig": string(kubeconfigsecret.Data["raw-kubeconfig"]),
-			})
+	var secrets map[string]*corev1.Secret
+	if opts.WithCredentials || opts.ShowSecretRefs {
+		var err error
+		if secrets, err = adminSecrets(k8sclient, namespace, clusterid); err != nil {
+			return nil, err
+		}
+	}
 
-		clusterinfo["cluster"] = cd
-		clusterinfo["consoleurl"] = cd.Status.WebConsoleURL
-		clusterinfo["timezone"] = cd.ObjectMeta.Labels["timezone"]
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	limiter := rate.NewLimiter(rate.Limit(opts.QPS), concurrency)
+
+	summaries := make([]ClusterSummary, len(cds))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				summaries[i] = summarizeCluster(ctx, limiter, hiveclient, k8sclient, &cds[i], secrets, opts)
+			}
+		}()
+	}
 
-		return clusterinfo
+	for i := range cds {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-	} else {
-		cds := hivev1.ClusterDeploymentList{}
-		opts := client.ListOptions{Namespace: "hive"}
+	sortSummaries(summaries, opts.SortBy)
 
-		err := hiveclient.List(context.Background(), &cds, &opts)
-		if err != nil {
-			log.Printf("Unable to get the cluster deployments from namespace hive: %v\n", err)
+	return summaries, nil
+}
+
+// infoSelector parses --selector into the label selector of the List call; --region is left to
+// matchesInfoFilters as the region can be in either the opl-region or the timezone label
+func infoSelector(opts infoOptions) (labels.Selector, error) {
+	selector, err := labels.Parse(opts.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", opts.Selector, err)
+	}
+
+	return selector, nil
+}
+
+// matchesInfoFilters applies the filters on region, annotations, power state and lease end
+func matchesInfoFilters(cd *hivev1.ClusterDeployment, opts infoOptions, now time.Time) bool {
+	summary := NewClusterSummary(cd)
+
+	if opts.Region != "" && summary.Region != opts.Region {
+		return false
+	}
+
+	if opts.Company != "" && !strings.EqualFold(summary.Company, opts.Company) {
+		return false
+	}
+
+	if opts.Sponsor != "" && !strings.EqualFold(summary.Sponsor, opts.Sponsor) {
+		return false
+	}
+
+	if opts.ExpiringWithin > 0 && (summary.LeaseEnd == nil || summary.LeaseEnd.After(now.Add(opts.ExpiringWithin))) {
+		return false
+	}
+
+	installed := summary.InstallStatus == InstallStatusInstalled
+	hibernating := summary.PowerState == string(hivev1.HibernatingClusterPowerState)
+
+	switch opts.State {
+	case "hibernating":
+		return installed && hibernating
+	case "running":
+		return installed && !hibernating
+	case "installing":
+		return summary.InstallStatus == InstallStatusInstalling
+	case "failed":
+		return summary.InstallStatus == InstallStatusFailed
+	}
+
+	return true
+}
+
+// sortSummaries orders the summaries by the --sort-by key; ties and the default keep the cluster id order
+func sortSummaries(summaries []ClusterSummary, by string) {
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+
+		switch by {
+		case "age":
+			return a.Created.Before(b.Created)
+		case "company":
+			return strings.ToLower(a.Company) < strings.ToLower(b.Company)
+		case "lease-end":
+			if a.LeaseEnd == nil || b.LeaseEnd == nil {
+				return a.LeaseEnd != nil
+			}
+			return a.LeaseEnd.Before(*b.LeaseEnd)
 		}
 
-		k8sclient := K8sAuthenticate()
-		clusters := make(map[string]interface{})
+		return false
+	})
+}
 
-		for _, cluster := range cds.Items {
-			clusterinfo := make(map[string]interface{})
+// summarizeCluster builds the summary of a single cluster, waiting on the limiter before every call to
+// the hub. The health check waits once for the kubeconfig secret it reads from the hub; its calls to the
+// partner cluster itself are not limited.
+func summarizeCluster(ctx context.Context, limiter *rate.Limiter, hiveclient client.Client, k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment, secrets map[string]*corev1.Secret, opts infoOptions) ClusterSummary {
+	summary := NewClusterSummary(cd)
+	summary.RequestURL = opts.Links.Request(cd.Name)
 
-			kubeadminsecret, err := k8sclient.CoreV1().Secrets("hive").Get(context.Background(), cluster.Spec.ClusterMetadata.AdminPasswordSecretRef.Name, metav1.GetOptions{})
-			if err != nil {
-				log.Printf("Unable to get the cluster kubeadmin secret: %v\n", err)
+	var errs []string
+
+	if !cd.Spec.Installed && cd.Status.ProvisionRef != nil {
+		provision := hivev1.ClusterProvision{}
+		nsn := types.NamespacedName{Namespace: cd.Namespace, Name: cd.Status.ProvisionRef.Name}
+
+		if err := limiter.Wait(ctx); err != nil {
+			errs = append(errs, err.Error())
+		} else if err = hiveclient.Get(ctx, nsn, &provision); err != nil {
+			errs = append(errs, fmt.Sprintf("unable to get ClusterProvision %v: %v", nsn.Name, err))
+		} else {
+			summary.SetProvision(&provision)
+		}
+	}
+
+	if opts.ShowSecretRefs {
+		summary.SecretRefs = AdminSecretRefs(cd)
+		for _, ref := range summary.SecretRefs {
+			if _, err := adminSecret(ctx, limiter, k8sclient, cd.Namespace, ref, secrets); apierrors.IsNotFound(err) {
+				errs = append(errs, "secret "+ref+" not found")
+			} else if err != nil {
+				errs = append(errs, fmt.Sprintf("unable to get secret %v: %v", ref, err))
 			}
+		}
+	}
 
-			kubeconfigsecret, err := k8sclient.CoreV1().Secrets("hive").Get(context.Background(), cluster.Spec.ClusterMetadata.AdminKubeconfigSecretRef.Name, metav1.GetOptions{})
+	if opts.WithCredentials {
+		if summary.PendingDeletionAt != nil {
+			errs = append(errs, "cluster is pending deletion, no credentials")
+		} else {
+			credentials, err := credentialLinks(ctx, limiter, k8sclient, cd, secrets)
 			if err != nil {
-				log.Printf("Unable to get the cluster kubeconfig secret: %v\n", err)
+				errs = append(errs, err.Error())
 			}
+			summary.Credentials = credentials
+		}
+	}
 
-			clusterinfo["credentials"] = GenerateMultiplePastes(os.Getenv("PRIVATEBIN_HOST"),
-				map[string]string{
-					"kubeadmin":  string(kubeadminsecret.Data["password"]),
-					"kubeconfig": string(kubeconfigsecret.Data["raw-kubeconfig"]),
-				})
+	if opts.Health {
+		if err := limiter.Wait(ctx); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			health := CheckHealth(ctx, k8sclient, cd)
+			summary.Health = &health
+		}
+	}
+
+	summary.Error = strings.Join(errs, "; ")
+
+	return summary
+}
+
+// adminSecrets lists the kubeconfig and kubeadmin secrets Hive created in the namespace with a single
+// call, only for the given cluster when clusterid is set, and returns them by name
+func adminSecrets(k8sclient *kubernetes.Clientset, namespace string, clusterid string) (map[string]*corev1.Secret, error) {
+	selector := fmt.Sprintf("%s in (%s,%s)", constants.SecretTypeLabel, constants.SecretTypeKubeConfig, constants.SecretTypeKubeAdminCreds)
+	if clusterid != "" {
+		selector += "," + constants.ClusterDeploymentNameLabel + "=" + clusterid
+	}
+
+	list, err := k8sclient.CoreV1().Secrets(namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list the admin secrets in namespace %v: %w", namespace, err)
+	}
+
+	secrets := make(map[string]*corev1.Secret, len(list.Items))
+	for i := range list.Items {
+		secrets[list.Items[i].Name] = &list.Items[i]
+	}
 
-			clusterinfo["cluster"] = cluster
-			clusterinfo["consoleurl"] = cluster.Status.WebConsoleURL
-			clusterinfo["timezone"] = cluster.ObjectMeta.Labels["timezone"]
+	return secrets, nil
+}
+
+// adminSecret returns a secret from the listed ones, or fetches it directly after waiting on the
+// limiter when it is missing from them, e.g. because it lacks Hive's labels
+func adminSecret(ctx context.Context, limiter *rate.Limiter, k8sclient *kubernetes.Clientset, namespace string, name string, secrets map[string]*corev1.Secret) (*corev1.Secret, error) {
+	if secret, ok := secrets[name]; ok {
+		return secret, nil
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return k8sclient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// credentialLinks shares the kubeadmin password and kubeconfig of the cluster through PrivateBin
+func credentialLinks(ctx context.Context, limiter *rate.Limiter, k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment, secrets map[string]*corev1.Secret) (map[string]string, error) {
+	if cd.Spec.ClusterMetadata == nil {
+		return nil, fmt.Errorf("cluster is not installed yet, no credentials")
+	}
+
+	kubeadminsecret, err := adminSecret(ctx, limiter, k8sclient, cd.Namespace, cd.Spec.ClusterMetadata.AdminPasswordSecretRef.Name, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the cluster kubeadmin secret: %w", err)
+	}
 
-			clusters[cluster.ObjectMeta.Name] = clusterinfo
+	kubeconfigsecret, err := adminSecret(ctx, limiter, k8sclient, cd.Namespace, cd.Spec.ClusterMetadata.AdminKubeconfigSecretRef.Name, secrets)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the cluster kubeconfig secret: %w", err)
+	}
+
+	return GenerateMultiplePastes(os.Getenv("PRIVATEBIN_HOST"),
+		map[string]string{
+			"kubeadmin":  string(kubeadminsecret.Data["password"]),
+			"kubeconfig": string(kubeconfigsecret.Data["raw-kubeconfig"]),
+		}), nil
+}
+
+// printSummaries writes the summaries in the given output format
+func printSummaries(out io.Writer, summaries []ClusterSummary, output string) error {
+	switch output {
+	case "json":
+		data, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(summaries)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	}
+
+	wide := output == "wide"
+
+	columns := []string{"CLUSTER ID", "STATE", "INSTALL", "PROBLEMS", "CONSOLE URL", "REQUEST URL"}
+	if wide {
+		columns = append(columns, "COMPANY", "REGION", "PLATFORM", "AGE", "LEASE END", "LAST ERROR")
+	}
+	credentials, health := false, false
+	for _, summary := range summaries {
+		if summary.SecretRefs != nil || summary.Credentials != nil {
+			credentials = true
+		}
+		if summary.Health != nil {
+			health = true
+		}
+	}
+	if health {
+		columns = append(columns, "HEALTH")
+	}
+	if credentials {
+		columns = append(columns, "KUBEADMIN", "KUBECONFIG")
+	}
+	columns = append(columns, "ERROR")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(w, strings.Join(columns, "\t")); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, summary := range summaries {
+		row := []string{summary.ClusterID, summary.State(), summary.Install(), problems(summary), summary.ConsoleURL, summary.RequestURL}
+		if wide {
+			row = append(row, summary.Company, summary.Region, summary.Platform,
+				duration.HumanDuration(now.Sub(summary.Created)), formatTime(summary.LeaseEnd), summary.LastError)
+		}
+		if health {
+			row = append(row, healthVerdict(summary.Health))
+		}
+		if credentials {
+			row = append(row, credential(summary, "kubeadmin"), credential(summary, "kubeconfig"))
+		}
+		row = append(row, summary.Error)
+
+		for i := range row {
+			if row[i] == "" {
+				row[i] = "-"
+			}
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return err
 		}
+	}
+
+	return w.Flush()
+}
 
-		return clusters
+// problems lists the type and reason of every condition reporting a problem
+func problems(summary ClusterSummary) string {
+	var conditions []string
+	for _, condition := range summary.Conditions {
+		if condition.Reason != "" {
+			conditions = append(conditions, condition.Type+":"+condition.Reason)
+		} else {
+			conditions = append(conditions, condition.Type)
+		}
 	}
+
+	return strings.Join(conditions, ",")
+}
+
+// credential returns the link to a credential, or the name of the secret holding it
+func credential(summary ClusterSummary, name string) string {
+	if link, ok := summary.Credentials[name]; ok {
+		return link
+	}
+
+	if ref, ok := summary.SecretRefs[name]; ok {
+		return "secret/" + ref
+	}
+
+	return ""
+}
+
+// formatTime prints an optional time as RFC3339
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
 }
 
 func init() {
 	flags := infoCmd.Flags()
 	flags.String("clusterid", "", "return information about a cluster")
+	flags.StringP("output", "o", "table", "output format; table, wide, json or yaml")
+	flags.Bool("with-credentials", false, "create one-time links to the kubeadmin password and kubeconfig (needs --clusterid)")
+	flags.Bool("show-secret-refs", false, "show the names of the secrets holding the kubeadmin password and kubeconfig")
+	flags.Bool("yes", false, "do not ask for confirmation before creating credential links")
+	flags.Int("concurrency", 8, "number of clusters looked up at the same time")
+	flags.Float64("qps", 10, "maximum number of calls per second made to the hub while looking up clusters")
+	flags.StringP("selector", "l", "", "label selector to filter clusters on, e.g. opl-lease-time=one-week")
+	flags.String("region", "", "only show clusters of the region; americas, emea or apac")
+	flags.String("sponsor", "", "only show clusters of the Red Hat sponsor")
+	flags.String("state", "", "only show clusters in the state; hibernating, running, installing or failed")
+	flags.Duration("expiring-within", 0, "only show clusters whose lease ends within the duration, e.g. 72h")
+	flags.String("sort-by", "id", "order of the clusters; id, age, company or lease-end")
+	flags.Bool("health", false, "check the health of every running cluster using its admin kubeconfig")
+	flags.BoolP("watch", "w", false, "keep a live table of the clusters, redrawn as they change")
 
 	rootCmd.AddCommand(infoCmd)
-
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// infoCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// infoCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
@@ -0,0 +1,198 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
+	runtimec "sigs.k8s.io/controller-runtime/pkg/client"
+
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+)
+
+var kubeconfigCmd = &cobra.Command{
+	Use:   "kubeconfig",
+	Short: "Fetch the admin kubeconfig of a cluster",
+	Long: `oplmgr kubeconfig --clusterid b592ec70-487f-44fc-a389-80bbf111ec96
+oplmgr kubeconfig --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --file /tmp/acme.kubeconfig
+oplmgr kubeconfig --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --remove
+
+Merges the admin kubeconfig Hive stored on the hub into ~/.kube/config, or the file passed with
+--kubeconfig, under a context named after the company and id of the cluster, e.g.
+opl-acme-corp-b592ec70-487f-44fc-a389-80bbf111ec96. The current context is left alone; switch to it
+with kubectl config use-context. With --file the kubeconfig is written as is to a new file instead.
+
+--remove takes the cluster's context, cluster and user out of the kubeconfig again.
+
+The kubeconfig gives full admin access to the partner's cluster, so every fetch and removal is
+recorded in the history of the cluster together with who ran it. No kubeconfig is written when the
+fetch cannot be recorded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterid, err := cmd.Flags().GetString("clusterid")
+		if err != nil {
+			log.Printf("Unable to get clusterid: %v\n", err)
+		}
+
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			log.Printf("Unable to get namespace: %v\n", err)
+		}
+
+		file, err := cmd.Flags().GetString("file")
+		if err != nil {
+			log.Printf("Unable to get the file flag: %v\n", err)
+		}
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			log.Printf("Unable to get the kubeconfig flag: %v\n", err)
+		}
+
+		remove, err := cmd.Flags().GetBool("remove")
+		if err != nil {
+			log.Printf("Unable to get the remove flag: %v\n", err)
+		}
+
+		if _, err = uuid.Parse(clusterid); err != nil {
+			log.Fatalf("A valid clusterid is required: %v\n", err)
+		}
+		if file != "" && remove {
+			log.Fatalln("--remove only works on the kubeconfig contexts are merged into, not with --file")
+		}
+		if kubeconfig == "" {
+			kubeconfig = clientcmd.RecommendedHomeFile
+		}
+
+		hiveclient := HiveClientK8sAuthenticate()
+		cdt := types.NamespacedName{Namespace: namespace, Name: clusterid}
+
+		if remove {
+			removed, err := RemoveKubeconfig(kubeconfig, clusterid)
+			if err != nil {
+				log.Fatalf("Unable to remove cluster %v from %v: %v\n", clusterid, kubeconfig, err)
+			}
+			if len(removed) == 0 {
+				log.Printf("No context of cluster %v found in %v\n", clusterid, kubeconfig)
+				return
+			}
+
+			log.Printf("Removed context %v from %v\n", strings.Join(removed, ", "), kubeconfig)
+			if err = recordEvent(hiveclient, cdt, AccessEvent, "admin kubeconfig removed from "+kubeconfig+" by "+operator()); err != nil {
+				log.Printf("Unable to record the access in the history of cluster %v: %v\n", clusterid, err)
+			}
+			return
+		}
+
+		cd := &hivev1.ClusterDeployment{}
+		if err = hiveclient.Get(context.Background(), cdt, cd); err != nil {
+			log.Fatalf("Unable to get cluster deployment: %v\n", err)
+		}
+
+		if deleteat, pending := PendingDeletion(cd); pending {
+			log.Fatalf("Cluster %v is pending deletion at %v; use oplmgr restore first\n", clusterid, deleteat.Format(time.RFC3339))
+		}
+
+		admin, err := AdminKubeconfig(K8sAuthenticate(), cd)
+		if err != nil {
+			log.Fatalf("Unable to get the admin kubeconfig of cluster %v: %v\n", clusterid, err)
+		}
+
+		name := KubeconfigContextName(cd)
+		detail := "admin kubeconfig merged into " + absolute(kubeconfig) + " as " + name
+		if file != "" {
+			detail = "admin kubeconfig written to " + absolute(file)
+		}
+
+		// the access is recorded before the kubeconfig is handed out so it is never left unaudited
+		if err = recordEvent(hiveclient, cdt, AccessEvent, detail+" by "+operator()); err != nil {
+			log.Fatalf("Unable to record the access in the history of cluster %v, no kubeconfig was written: %v\n", clusterid, err)
+		}
+
+		if file != "" {
+			if err = WriteKubeconfig(file, admin); err != nil {
+				log.Fatalf("Unable to write the admin kubeconfig of cluster %v: %v\n", clusterid, err)
+			}
+			log.Printf("Wrote the admin kubeconfig of cluster %v to %v\n", clusterid, file)
+			return
+		}
+
+		if err = MergeKubeconfig(kubeconfig, admin, name); err != nil {
+			log.Fatalf("Unable to merge the admin kubeconfig of cluster %v: %v\n", clusterid, err)
+		}
+		log.Printf("Merged the admin kubeconfig of cluster %v into %v; kubectl config use-context %v\n", clusterid, kubeconfig, name)
+	},
+}
+
+// recordEvent adds an event to the history of the cluster, retrying when the cluster was changed in
+// the meantime, and returns an error when it could not be recorded
+func recordEvent(hiveclient runtimec.Client, cdt types.NamespacedName, kind string, detail string) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cd := &hivev1.ClusterDeployment{}
+		if err := hiveclient.Get(context.Background(), cdt, cd); err != nil {
+			return err
+		}
+
+		RecordHistory(cd, kind, detail)
+
+		return hiveclient.Update(context.Background(), cd)
+	})
+}
+
+// operator identifies who ran oplmgr for the audit trail, e.g. jdoe@laptop
+func operator() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		return fmt.Sprintf("%s@%s", name, host)
+	}
+
+	return name
+}
+
+// absolute returns the absolute path of a file for the audit trail, or the path as given
+func absolute(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return path
+}
+
+func init() {
+	flags := kubeconfigCmd.Flags()
+	flags.StringP("file", "f", "", "write the admin kubeconfig to this new file instead of merging it")
+	flags.String("kubeconfig", "", "kubeconfig to merge the context into (default ~/.kube/config)")
+	flags.Bool("remove", false, "remove the context of the cluster from the kubeconfig")
+
+	rootCmd.AddCommand(kubeconfigCmd)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/viper"
+
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+)
+
+// hubLinks returns the links for the hub of the current kube context. The links key of the config
+// file overrides the defaults and the entry of the hubs key matching the context overrides both.
+func hubLinks() Links {
+	links := DefaultLinks()
+
+	configured := Links{}
+	if err := viper.UnmarshalKey("links", &configured); err != nil {
+		log.Printf("Unable to parse the links of the config file: %v\n", err)
+	}
+	links = links.Merge(configured)
+
+	var hubs []HubLinks
+	if err := viper.UnmarshalKey("hubs", &hubs); err != nil {
+		log.Printf("Unable to parse the hubs of the config file: %v\n", err)
+	}
+
+	context := CurrentHubContext()
+	for _, hub := range hubs {
+		if hub.Context == context {
+			links = links.Merge(hub.Links)
+		}
+	}
+
+	return links
+}
+
+// linkInfo adds the links of a lab to the data of an email template
+func linkInfo(clusterinfo map[string]string, links Links, clusterid string) map[string]string {
+	clusterinfo["requesturl"] = links.Request(clusterid)
+	clusterinfo["supporturl"] = links.SupportURL
+	clusterinfo["supportemail"] = links.SupportEmail
+
+	return clusterinfo
+}
@@ -0,0 +1,198 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var emailFlushCmd = &cobra.Command{
+	Use:   "flush",
+	Short: "Retry the emails kept in the outbox",
+	Long: `oplmgr email flush
+oplmgr email flush --force
+
+Emails the SMTP server did not take are kept in the outbox, --outbox-dir, the email.outbox-dir key of
+the config file or $HOME/.oplmgr/outbox, as they were rendered, so the credential links they hold
+are not lost. Meant to run periodically (e.g. every 5 minutes from cron), flush sends the emails
+whose retry is due. The first retry waits a minute and every failed attempt doubles the wait, up
+to six hours. --force retries every email straight away.
+
+Emails queued more than --max-age ago (24h by default, or the email.outbox-max-age key of the config
+file) are not sent anymore, as the privatebin links they hold have expired by then. They are moved
+to the expired directory of the outbox instead.
+
+Only one flush works on an outbox at a time; a flush started while another one is still sending
+exits without sending anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			log.Printf("Unable to get the force flag: %v\n", err)
+		}
+
+		maxage := durationSetting(cmd, "max-age", "email.outbox-max-age")
+
+		dir := outboxDir(cmd)
+
+		lock, err := LockOutbox(dir)
+		if err != nil {
+			log.Printf("Not flushing the outbox: %v\n", err)
+			return
+		}
+		defer func() {
+			if err := lock.Unlock(); err != nil {
+				log.Printf("Unable to unlock the outbox: %v\n", err)
+			}
+		}()
+
+		entries, err := ListOutbox(dir)
+		if err != nil {
+			log.Fatalf("Unable to read the outbox: %v\n", err)
+		}
+
+		mailer, err := smtpMailer()
+		if err != nil {
+			log.Fatalf("Unable to set up email: %v\n", err)
+		}
+
+		now := time.Now()
+		sent, failed, expired := 0, 0, 0
+		for _, entry := range entries {
+			if entry.Expired(now, maxage) {
+				expired++
+				log.Printf("Not sending %v to %v, it was queued at %v: %v\n", entry.ID, strings.Join(entry.Message.To, ","), entry.QueuedAt.Format(time.RFC3339), entry.LastError)
+				if err = ExpireOutboxEntry(dir, entry); err != nil {
+					log.Printf("Unable to update the outbox: %v\n", err)
+				}
+				continue
+			}
+
+			if !force && !entry.Due(now) {
+				continue
+			}
+
+			if err = lock.Refresh(); err != nil {
+				log.Printf("Unable to refresh the outbox lock: %v\n", err)
+			}
+
+			if err = mailer.SendMessage(&entry.Message); err != nil {
+				failed++
+				entry.Failed(err, time.Now())
+				log.Printf("Unable to send %v; retrying after %v: %v\n", entry.ID, entry.NextAttempt.Format(time.RFC3339), err)
+				if err = SaveOutboxEntry(dir, entry); err != nil {
+					log.Printf("Unable to update the outbox: %v\n", err)
+				}
+				continue
+			}
+
+			sent++
+			log.Printf("Sent %v to %v\n", entry.ID, strings.Join(entry.Message.To, ","))
+			if err = RemoveOutboxEntry(dir, entry); err != nil {
+				log.Printf("Unable to update the outbox: %v\n", err)
+			}
+			if entry.History {
+				recordEmail(entry.ClusterID, entry.Message.Kind, messageRecipients(&entry.Message))
+			}
+		}
+
+		fmt.Printf("%d sent, %d failed, %d expired, %d left in the outbox\n", sent, failed, expired, len(entries)-sent-expired)
+		if failed > 0 || expired > 0 {
+			if err = lock.Unlock(); err != nil {
+				log.Printf("Unable to unlock the outbox: %v\n", err)
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+var emailQueueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Inspect the emails kept in the outbox",
+}
+
+var emailQueueListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the emails waiting in the outbox",
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := ListOutbox(outboxDir(cmd))
+		if err != nil {
+			log.Fatalf("Unable to read the outbox: %v\n", err)
+		}
+
+		if len(entries) == 0 {
+			fmt.Println("The outbox is empty")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, err = fmt.Fprintln(w, "ID\tCLUSTER ID\tTYPE\tTO\tQUEUED AT\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+		for _, entry := range entries {
+			_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", entry.ID, entry.ClusterID, entry.Message.Kind, strings.Join(entry.Message.To, ","),
+				entry.QueuedAt.Format(time.RFC3339), entry.Attempts, entry.NextAttempt.Format(time.RFC3339), entry.LastError)
+		}
+		if err != nil {
+			log.Printf("Unable to print the outbox: %v\n", err)
+		}
+
+		if err = w.Flush(); err != nil {
+			log.Printf("Unable to print the outbox: %v\n", err)
+		}
+	},
+}
+
+// outboxDir returns where emails that could not be sent are kept; the outbox-dir flag, the
+// email.outbox-dir key of the config file or ~/.oplmgr/outbox
+func outboxDir(cmd *cobra.Command) string {
+	dir, err := cmd.Flags().GetString("outbox-dir")
+	if err != nil {
+		log.Printf("Unable to get the outbox-dir flag: %v\n", err)
+	}
+
+	if dir == "" {
+		dir = viper.GetString("email.outbox-dir")
+	}
+
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			log.Printf("Unable to get user's home directory: %v\n", err)
+		}
+		dir = filepath.Join(home, ".oplmgr", "outbox")
+	}
+
+	return dir
+}
+
+func init() {
+	emailCmd.PersistentFlags().String("outbox-dir", "", "directory emails that could not be sent are kept in (default is $HOME/.oplmgr/outbox)")
+	emailFlushCmd.Flags().Bool("force", false, "retry every email in the outbox, also those whose retry is not due yet")
+	emailFlushCmd.Flags().Duration("max-age", OutboxMaxAge, "stop retrying emails queued longer ago than this")
+
+	emailQueueCmd.AddCommand(emailQueueListCmd)
+	emailCmd.AddCommand(emailFlushCmd)
+	emailCmd.AddCommand(emailQueueCmd)
+}
@@ -800,6 +800,24 @@ func (o *Options) GenerateObjects() ([]runtime.Object, error) {
 		result = append(result, o.generateSampleSyncSets()...)
 	}
 
+	// Label everything created for this lab so delete can find it again. SelectorSyncSets are
+	// shared between clusters and left out.
+	for _, obj := range result {
+		if _, ok := obj.(*hivev1.SelectorSyncSet); ok {
+			continue
+		}
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		labels := accessor.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[OwnerLabel] = o.Name
+		accessor.SetLabels(labels)
+	}
+
 	return result, nil
 }
 
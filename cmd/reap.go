@@ -0,0 +1,265 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reapResult is a line of the summary printed once reap is done
+type reapResult struct {
+	ClusterID  string
+	Company    string
+	Due        time.Time
+	Result     string
+	RequestURL string
+}
+
+// reapCmd represents the reap command
+var reapCmd = &cobra.Command{
+	Use:   "reap",
+	Short: "Delete clusters whose lease has ended",
+	Long: `oplmgr reap --dry-run
+oplmgr reap --grace 24h
+
+Finds the clusters whose lease ended more than the grace period ago. The lease end is taken from
+the opl-lease-end annotation, Hive's delete-after annotation or the opl-lease-time label, in that
+order. Each of them is archived like "oplmgr archive" describes, deleted like "oplmgr delete"
+would and its contacts get a final notice. Notices that cannot be sent are kept in the outbox
+for "oplmgr email flush" to retry. Clusters labelled opl-protected=true are skipped. A summary is
+printed at the end.
+
+Hive needs the cloud credentials of a lab to deprovision it, so they are kept when the lab is
+deleted and removed by the next run of reap once the ClusterDeployment is gone.
+
+Clusters soft deleted with "oplmgr delete --soft" are deleted the same way once their own grace
+period, recorded in the opl-delete-at annotation, is over.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			log.Printf("Unable to get namespace: %v\n", err)
+		}
+
+		dryrun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Printf("Unable to get the dry-run flag: %v\n", err)
+		}
+
+		grace, err := cmd.Flags().GetDuration("grace")
+		if err != nil {
+			log.Printf("Unable to get the grace flag: %v\n", err)
+		}
+
+		notify, err := cmd.Flags().GetBool("notify")
+		if err != nil {
+			log.Printf("Unable to get the notify flag: %v\n", err)
+		}
+
+		archivedir := archiveDir(cmd)
+
+		// every lab is archived before it is deleted, so without a key every one of them would fail
+		if err = checkArchiveKey(); err != nil {
+			if !dryrun {
+				log.Fatalf("Unable to archive the expired labs, nothing was deleted: %v\n", err)
+			}
+			log.Printf("Warning: %v\n", err)
+		}
+
+		var mailer *Mailer
+		if notify {
+			if mailer, err = newMailer(cmd); err != nil {
+				log.Fatalf("Unable to set up email: %v\n", err)
+			}
+			mailer.Outbox = outboxDir(cmd)
+		}
+
+		hiveclient := HiveClientK8sAuthenticate()
+		k8sclient := K8sAuthenticate()
+
+		// labs are deleted without waiting for the deprovision, so the cloud credentials of the ones
+		// deleted by earlier runs are only removed now that their ClusterDeployment is gone
+		if err = DeleteOrphanedLabSecrets(hiveclient, k8sclient, namespace, dryrun); err != nil {
+			log.Printf("Unable to delete the secrets of deleted labs: %v\n", err)
+		}
+
+		cds := hivev1.ClusterDeploymentList{}
+		if err = hiveclient.List(context.Background(), &cds, &client.ListOptions{Namespace: namespace}); err != nil {
+			log.Fatalf("Unable to get the cluster deployments from namespace %v: %v\n", namespace, err)
+		}
+
+		now := time.Now()
+		links := hubLinks()
+		var results []reapResult
+
+		for i := range cds.Items {
+			cd := &cds.Items[i]
+
+			due, reason, expired := reapDue(cd, now, grace)
+			if !expired || cd.DeletionTimestamp != nil {
+				continue
+			}
+
+			result := reapResult{ClusterID: cd.Name, Company: cd.Annotations[CompanyAnnotation], Due: due, RequestURL: links.Request(cd.Name)}
+
+			result.Result = reap(hiveclient, k8sclient, mailer, cd, due, reason, archivedir, dryrun)
+			results = append(results, result)
+		}
+
+		printReapSummary(results, dryrun)
+	},
+}
+
+// reapDue returns when the lab is due for deletion, why, and whether that time has come. A soft deleted
+// lab is only due once its own grace period is over, whatever its lease says, so it can be restored
+// until then.
+func reapDue(cd *hivev1.ClusterDeployment, now time.Time, grace time.Duration) (time.Time, string, bool) {
+	if deleteat, pending := PendingDeletion(cd); pending {
+		return deleteat, "soft delete grace period ended", !now.Before(deleteat)
+	}
+
+	due, ok := LeaseEnd(cd)
+
+	return due, "lease ended", ok && !now.Before(due.Add(grace))
+}
+
+// reap archives, deletes and notifies the contacts of a single expired lab and returns the outcome for
+// the summary; contacts are not notified when mailer is nil
+func reap(hiveclient client.Client, k8sclient *kubernetes.Clientset, mailer *Mailer, cd *hivev1.ClusterDeployment, due time.Time, reason string, archivedir string, dryrun bool) string {
+	if err := checkDeletable(cd, true, time.Now()); err != nil {
+		log.Printf("Skipping cluster %v: %v\n", cd.Name, err)
+		return "skipped: " + err.Error()
+	}
+
+	if dryrun {
+		return "would delete"
+	}
+
+	if err := archiveLab(k8sclient, cd, archivedir, reason); err != nil {
+		log.Printf("Unable to archive cluster %v: %v\n", cd.Name, err)
+		return "failed: " + err.Error()
+	}
+
+	// the lab secret the contacts may be kept in is deleted along with the lab
+	contacts, err := LabContacts(k8sclient, cd)
+	if err != nil && mailer != nil {
+		log.Printf("Unable to get the contacts of cluster %v: %v\n", cd.Name, err)
+	}
+
+	if err := deleteLab(hiveclient, k8sclient, cd, false, 0); err != nil {
+		log.Printf("Unable to delete cluster %v: %v\n", cd.Name, err)
+		return "failed: " + err.Error()
+	}
+
+	if mailer != nil {
+		if entry, err := sendDeletionNotice(mailer, cd, contacts, due); entry != nil {
+			log.Printf("Unable to send the final notice for cluster %v, queued as %v: %v\n", cd.Name, entry.ID, err)
+			return "deleted, notice queued"
+		} else if err != nil {
+			log.Printf("Unable to send the final notice for cluster %v: %v\n", cd.Name, err)
+			return "deleted, notice failed"
+		}
+	}
+
+	return "deleted"
+}
+
+// sendDeletionNotice lets the contacts of the cluster know it is gone. A notice the SMTP server does
+// not take is put in the outbox and returned along with the error.
+func sendDeletionNotice(mailer *Mailer, cd *hivev1.ClusterDeployment, contacts Contacts, due time.Time) (*OutboxEntry, error) {
+	to := contacts.To()
+	if len(to) == 0 {
+		return nil, fmt.Errorf("no contacts recorded on the cluster")
+	}
+
+	clusterinfo := map[string]string{
+		"clusterid":  strings.Split(cd.Name, "-")[0],
+		"company":    cd.Annotations[CompanyAnnotation],
+		"sponsor":    cd.Annotations[SponsorAnnotation],
+		"consoleurl": cd.Status.WebConsoleURL,
+		"when":       due.UTC().Format("Mon Jan 2 15:04 MST"),
+	}
+	clusterinfo = linkInfo(clusterinfo, hubLinks(), cd.Name)
+
+	message, err := mailer.Render("deletion-notice", to, contacts.Cc(), nil, clusterinfo)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cluster is gone by now so there is no history to record the notice in
+	return mailer.SendOrQueue(message, cd.Name, false)
+}
+
+func printReapSummary(results []reapResult, dryrun bool) {
+	deleted, skipped, failed := 0, 0, 0
+	for _, result := range results {
+		switch {
+		case strings.HasPrefix(result.Result, "skipped"):
+			skipped++
+		case strings.HasPrefix(result.Result, "failed"):
+			failed++
+		default:
+			deleted++
+		}
+	}
+
+	action := "deleted"
+	if dryrun {
+		action = "to delete"
+	}
+
+	fmt.Printf("\n%d expired, %d %s, %d skipped, %d failed\n\n", len(results), deleted, action, skipped, failed)
+	if len(results) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, err := fmt.Fprintln(w, "CLUSTER ID\tCOMPANY\tDUE\tRESULT\tREQUEST URL")
+	for _, result := range results {
+		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", result.ClusterID, result.Company, result.Due.Format(time.RFC3339), result.Result, result.RequestURL)
+	}
+	if err != nil {
+		log.Printf("Unable to print the reap summary: %v\n", err)
+	}
+
+	if err = w.Flush(); err != nil {
+		log.Printf("Unable to print the reap summary: %v\n", err)
+	}
+}
+
+func init() {
+	flags := reapCmd.Flags()
+	flags.Bool("dry-run", false, "only report the clusters that would be deleted")
+	flags.Duration("grace", 0, "only delete clusters whose lease ended at least this long ago (e.g. 24h)")
+	flags.Bool("notify", true, "send a final notice to the contacts of each deleted cluster")
+	flags.String("archive-dir", "", "directory the lab archives are kept in (default is $HOME/.oplmgr/archive)")
+	flags.String("templates-dir", "", "directory with email templates overriding the built in ones")
+	flags.String("outbox-dir", "", "directory notices that could not be sent are kept in (default is $HOME/.oplmgr/outbox)")
+
+	rootCmd.AddCommand(reapCmd)
+}
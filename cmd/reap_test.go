@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReapDue(t *testing.T) {
+	now := time.Date(2021, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	lab := func(leaseend time.Time) *hivev1.ClusterDeployment {
+		return &hivev1.ClusterDeployment{ObjectMeta: metav1.ObjectMeta{
+			Name:        "b592ec70-487f-44fc-a389-80bbf111ec96",
+			Labels:      map[string]string{},
+			Annotations: map[string]string{LeaseEndAnnotation: leaseend.Format(time.RFC3339)},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		leaseend time.Time
+		softat   *time.Time
+		grace    time.Duration
+		due      time.Time
+		expired  bool
+	}{
+		{"lease running", now.Add(time.Hour), nil, 0, now.Add(time.Hour), false},
+		{"lease ended", now.Add(-time.Hour), nil, 0, now.Add(-time.Hour), true},
+		{"lease ended within grace", now.Add(-time.Hour), nil, 2 * time.Hour, now.Add(-time.Hour), false},
+		{"soft deleted after the lease ended", now.Add(-48 * time.Hour), timePtr(now.Add(-time.Hour)), 0, now.Add(71 * time.Hour), false},
+		{"soft delete grace over", now.Add(-96 * time.Hour), timePtr(now.Add(-73 * time.Hour)), 0, now.Add(-time.Hour), true},
+		{"soft deleted before the lease ended", now.Add(24 * time.Hour), timePtr(now.Add(-73 * time.Hour)), 0, now.Add(-time.Hour), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cd := lab(test.leaseend)
+			if test.softat != nil {
+				SoftDelete(cd, 72*time.Hour, *test.softat)
+			}
+
+			due, _, expired := reapDue(cd, now, test.grace)
+			if expired != test.expired {
+				t.Errorf("expired = %v, want %v", expired, test.expired)
+			}
+			if !due.Equal(test.due) {
+				t.Errorf("due = %v, want %v", due, test.due)
+			}
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
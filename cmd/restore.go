@@ -0,0 +1,82 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"log"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Undo the soft delete of a Hive ClusterDeployment",
+	Long: `oplmgr restore --clusterid b592ec70-487f-44fc-a389-80bbf111ec96
+
+Removes the opl-pending-deletion label set by "oplmgr delete --soft" and puts the cluster back in
+the power state it had before. This works as long as "oplmgr reap" has not deleted the cluster yet.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		clusterid, err := cmd.Flags().GetString("clusterid")
+		if err != nil {
+			log.Printf("Unable to get clusterid: %v\n", err)
+		}
+
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			log.Printf("Unable to get namespace: %v\n", err)
+		}
+
+		client := HiveClientK8sAuthenticate()
+
+		cdt := &hivev1.ClusterDeployment{}
+		if err = client.Get(context.Background(), types.NamespacedName{Namespace: namespace, Name: clusterid}, cdt); err != nil {
+			log.Fatalf("Unable to get cluster deployment %v: %v\n", clusterid, err)
+		}
+
+		if cdt.DeletionTimestamp != nil {
+			log.Fatalf("Cluster %v is already being deleted and cannot be restored\n", clusterid)
+		}
+
+		deleteat, pending := PendingDeletion(cdt)
+		if !pending {
+			log.Fatalf("Cluster %v is not pending deletion\n", clusterid)
+		}
+
+		if deleteat.Before(time.Now()) {
+			log.Printf("Warning: the grace period of cluster %v ended at %v\n", clusterid, deleteat.Format(time.RFC3339))
+		}
+
+		Restore(cdt)
+		RecordHistory(cdt, DeleteEvent, "restored")
+
+		if err = client.Update(context.Background(), cdt); err != nil {
+			log.Fatalf("Unable to restore cluster deployment %v: %v\n", clusterid, err)
+		}
+
+		log.Printf("Restored cluster %v with powerState %v\n", clusterid, currentPowerState(cdt))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -70,13 +70,13 @@ func Execute() {
 
 func init() {
 	perflags := rootCmd.PersistentFlags()
-	//cobra.OnInitialize(initConfig)
+	cobra.OnInitialize(initConfig)
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	//rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.oplmgr.yaml)")
+	perflags.StringVar(&cfgFile, "config", "", "config file (default is $HOME/.oplmgr.yaml)")
 	perflags.StringVar(&ClusterId, "clusterid", "", "id of cluster to interact with")
 	perflags.StringVar(&Namespace, "namespace", "hive", "namespace to interact with")
 	perflags.StringVar(&Company, "company", "redhat", "company name provided by request form")
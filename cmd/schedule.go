@@ -0,0 +1,338 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Wake or hibernate clusters according to their region's calendar",
+	Long: `oplmgr schedule
+oplmgr schedule --calendar calendar.yaml --dry-run
+
+Meant to run periodically (e.g. every 15 minutes from cron). Every installed cluster is woken
+during the working hours of the region in its opl-region label, or its timezone label for older
+labs, and hibernated outside of them.
+Weekends and holidays are treated as non-working days unless the cluster is labelled
+opl-weekend-hibernation=false. Clusters woken with "oplmgr wake --for" are left running until
+their deadline and then return to the schedule. Soft deleted clusters are left hibernating.
+
+The contacts recorded on each cluster, or in its lab secret, are warned by email ahead of the
+daily hibernation and ahead of the end of the lease, with the sponsor in cc; by default 30 minutes
+before hibernation and 48 and 2 hours before deletion. Sent warnings are recorded on the cluster
+so they go out only once. The lead times can also be set with the warnings.hibernate and
+warnings.delete keys of the config file.
+
+The calendar is a YAML file, set with --calendar or the calendar key of the config file:
+
+regions:
+  americas:
+    location: America/Panama
+    start: "09:00"
+    end: "17:00"
+    workdays: [Mon, Tue, Wed, Thu, Fri]
+    holidays: ["2021-12-24", "2021-12-31"]
+    ical: /etc/oplmgr/americas-holidays.ics
+
+Regions and fields that are left out fall back to 9am to 5pm, Monday to Friday in the
+timezones listed by "oplmgr --help". Working hours must end after they start on the same day.
+
+Every day covered by an event of the ical file is a holiday, including the days up to its DTEND
+and the yearly recurrences of events with a FREQ=YEARLY RRULE. Files with other recurrences,
+RDATE or EXDATE are rejected.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			log.Printf("Unable to get namespace: %v\n", err)
+		}
+
+		calendarfile, err := cmd.Flags().GetString("calendar")
+		if err != nil {
+			log.Printf("Unable to get the calendar flag: %v\n", err)
+		}
+		if calendarfile == "" {
+			calendarfile = viper.GetString("calendar")
+		}
+
+		dryrun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			log.Printf("Unable to get the dry-run flag: %v\n", err)
+		}
+
+		sendwarnings, err := cmd.Flags().GetBool("warnings")
+		if err != nil {
+			log.Printf("Unable to get the warnings flag: %v\n", err)
+		}
+
+		hibernatewarnings := durationsSetting(cmd, "hibernate-warnings", "warnings.hibernate")
+		deletewarnings := durationsSetting(cmd, "delete-warnings", "warnings.delete")
+
+		calendar, err := LoadCalendar(calendarfile)
+		if err != nil {
+			log.Printf("Unable to load the calendar: %v\n", err)
+			return
+		}
+
+		var mailer *Mailer
+		var k8sclient *kubernetes.Clientset
+		if sendwarnings {
+			// a broken email setup must not keep the clusters from being woken and hibernated
+			if mailer, err = newMailer(cmd); err != nil {
+				log.Printf("Unable to set up email; scheduling without warnings: %v\n", err)
+				sendwarnings = false
+			} else {
+				k8sclient = K8sAuthenticate()
+			}
+		}
+
+		hiveclient := HiveClientK8sAuthenticate()
+
+		cds := hivev1.ClusterDeploymentList{}
+		if err = hiveclient.List(context.Background(), &cds, &client.ListOptions{Namespace: namespace}); err != nil {
+			log.Printf("Unable to get the cluster deployments from namespace %v: %v\n", namespace, err)
+			return
+		}
+
+		now := time.Now()
+		for i := range cds.Items {
+			cd := &cds.Items[i]
+
+			// finished temporary wakes are cleared from every cluster, whether it is scheduled or not
+			update := ExpireTemporaryWake(cd, now)
+			if update {
+				log.Printf("Temporary wake of cluster %v is over, restoring its hibernateAfter\n", cd.Name)
+			}
+
+			if _, pending := PendingDeletion(cd); cd.Spec.Installed && !pending {
+				update = scheduleCluster(mailer, k8sclient, calendar, cd, now, hibernatewarnings, deletewarnings, sendwarnings, dryrun) || update
+			}
+
+			if !update || dryrun {
+				continue
+			}
+
+			if err = hiveclient.Update(context.Background(), cd); err != nil {
+				log.Printf("Unable to update cluster deployment %v: %v\n", cd.Name, err)
+			}
+		}
+	},
+}
+
+// scheduleCluster sends the warnings that are due and sets the power state the calendar asks for. It
+// returns whether the cluster needs to be updated.
+func scheduleCluster(mailer *Mailer, k8sclient *kubernetes.Clientset, calendar *Calendar, cd *hivev1.ClusterDeployment, now time.Time, hibernatewarnings []time.Duration, deletewarnings []time.Duration, sendwarnings bool, dryrun bool) bool {
+	update := false
+	if sendwarnings {
+		update = warnContacts(mailer, k8sclient, calendar, cd, now, hibernatewarnings, deletewarnings, dryrun)
+	}
+
+	powerstate, err := scheduledPowerState(calendar, cd, now)
+	if err != nil {
+		log.Printf("Unable to schedule cluster %v: %v\n", cd.Name, err)
+	} else if currentPowerState(cd) != powerstate {
+		log.Printf("Setting powerState of cluster %v to %v\n", cd.Name, powerstate)
+		cd.Spec.PowerState = powerstate
+		RecordHistory(cd, PowerEvent, string(powerstate)+" by oplmgr schedule")
+		update = true
+	}
+
+	return update
+}
+
+// scheduledPowerState returns the power state the cluster should be in at t
+func scheduledPowerState(calendar *Calendar, cd *hivev1.ClusterDeployment, t time.Time) (hivev1.ClusterPowerState, error) {
+	if until, ok := TemporaryWakeDeadline(cd); ok && t.Before(until) {
+		return hivev1.RunningClusterPowerState, nil
+	}
+
+	run, err := calendar.ShouldRun(cd, t)
+	if err != nil {
+		return "", err
+	}
+
+	if run {
+		return hivev1.RunningClusterPowerState, nil
+	}
+
+	return hivev1.HibernatingClusterPowerState, nil
+}
+
+// warnContacts emails the contacts of the cluster the hibernation and deletion warnings that are due
+// and records them on the cluster. It returns whether the cluster needs to be updated.
+func warnContacts(mailer *Mailer, k8sclient *kubernetes.Clientset, calendar *Calendar, cd *hivev1.ClusterDeployment, now time.Time, hibernatewarnings []time.Duration, deletewarnings []time.Duration, dryrun bool) bool {
+	update := false
+
+	location := time.UTC
+	if region, err := calendar.Region(cd); err == nil {
+		location = region.Zone()
+	}
+
+	if currentPowerState(cd) == hivev1.RunningClusterPowerState {
+		if sleepat, ok := calendar.NextHibernation(cd, now); ok {
+			update = warnContact(mailer, k8sclient, cd, HibernationWarning, sleepat.In(location), now, hibernatewarnings, dryrun) || update
+		}
+	}
+
+	if leaseend, ok := LeaseEnd(cd); ok {
+		update = warnContact(mailer, k8sclient, cd, DeletionWarning, leaseend.In(location), now, deletewarnings, dryrun) || update
+	}
+
+	return update
+}
+
+// warnContact sends a single warning unless every warning due for the deadline was already sent
+func warnContact(mailer *Mailer, k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment, kind string, deadline time.Time, now time.Time, leads []time.Duration, dryrun bool) bool {
+	keys := DueWarnings(kind, deadline, now, leads)
+
+	pending := false
+	for _, key := range keys {
+		if !WarningSent(cd, key) {
+			pending = true
+		}
+	}
+
+	if !pending {
+		return false
+	}
+
+	contacts, err := LabContacts(k8sclient, cd)
+	if err != nil {
+		log.Printf("Unable to get the contacts of cluster %v: %v\n", cd.Name, err)
+	}
+
+	to := contacts.To()
+	if len(to) == 0 {
+		log.Printf("No contacts recorded on cluster %v to send the %v warning to\n", cd.Name, kind)
+		return false
+	}
+
+	octet := strings.Split(cd.Name, "-")[0]
+	remaining := formatRemaining(deadline.Sub(now))
+
+	message := "hibernation-warning"
+	if kind == DeletionWarning {
+		message = "deletion-warning"
+	}
+
+	log.Printf("Sending %v warning for cluster %v to %v\n", kind, cd.Name, strings.Join(to, ","))
+	if dryrun {
+		return false
+	}
+
+	clusterinfo := map[string]string{
+		"clusterid":  octet,
+		"company":    cd.Annotations[CompanyAnnotation],
+		"sponsor":    cd.Annotations[SponsorAnnotation],
+		"consoleurl": cd.Status.WebConsoleURL,
+		"when":       deadline.Format("Mon Jan 2 15:04 MST"),
+		"remaining":  remaining,
+	}
+	clusterinfo = linkInfo(clusterinfo, hubLinks(), cd.Name)
+
+	if err := mailer.Send(message, to, contacts.Cc(), nil, clusterinfo); err != nil {
+		log.Printf("Unable to send the %v warning for cluster %v: %v\n", kind, cd.Name, err)
+		return false
+	}
+
+	RecordWarnings(cd, keys)
+	RecordHistory(cd, EmailEvent, kind+" warning sent to "+strings.Join(append(to, contacts.Cc()...), ","))
+
+	return true
+}
+
+// formatRemaining rounds to the minute and drops the zero units time.Duration prints (48h0m0s becomes 48h)
+func formatRemaining(d time.Duration) string {
+	remaining := d.Round(time.Minute).String()
+	remaining = strings.TrimSuffix(remaining, "0s")
+	if strings.HasSuffix(remaining, "h0m") {
+		remaining = strings.TrimSuffix(remaining, "0m")
+	}
+
+	return remaining
+}
+
+// durationsSetting returns the durations of a flag, or of the config key when the flag was not set
+func durationsSetting(cmd *cobra.Command, flag string, key string) []time.Duration {
+	durations, err := cmd.Flags().GetDurationSlice(flag)
+	if err != nil {
+		log.Printf("Unable to get the %v flag: %v\n", flag, err)
+	}
+
+	if cmd.Flags().Changed(flag) || !viper.IsSet(key) {
+		return durations
+	}
+
+	durations = nil
+	for _, value := range viper.GetStringSlice(key) {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Unable to parse %v from %v: %v\n", value, key, err)
+			continue
+		}
+		durations = append(durations, duration)
+	}
+
+	return durations
+}
+
+// durationSetting returns the duration of a flag, or of the config key when the flag was not set
+func durationSetting(cmd *cobra.Command, flag string, key string) time.Duration {
+	duration, err := cmd.Flags().GetDuration(flag)
+	if err != nil {
+		log.Printf("Unable to get the %v flag: %v\n", flag, err)
+	}
+
+	if cmd.Flags().Changed(flag) || !viper.IsSet(key) {
+		return duration
+	}
+
+	return viper.GetDuration(key)
+}
+
+// currentPowerState treats an unset powerState as Running like Hive does
+func currentPowerState(cd *hivev1.ClusterDeployment) hivev1.ClusterPowerState {
+	if cd.Spec.PowerState == "" {
+		return hivev1.RunningClusterPowerState
+	}
+
+	return cd.Spec.PowerState
+}
+
+func init() {
+	flags := scheduleCmd.Flags()
+	flags.String("calendar", "", "YAML file with the working hours, workdays and holidays of each region")
+	flags.Bool("dry-run", false, "only print the power state changes and warnings")
+	flags.String("templates-dir", "", "directory with email templates overriding the built in ones")
+	flags.Bool("warnings", true, "email the contacts of clusters ahead of hibernation and deletion")
+	flags.DurationSlice("hibernate-warnings", []time.Duration{30 * time.Minute}, "comma separated lead times of the warnings sent before the daily hibernation")
+	flags.DurationSlice("delete-warnings", []time.Duration{48 * time.Hour, 2 * time.Hour}, "comma separated lead times of the warnings sent before the lease ends")
+
+	rootCmd.AddCommand(scheduleCmd)
+}
@@ -54,7 +54,9 @@ var sleepCmd = &cobra.Command{
 			log.Printf("Unable to get cluster deployment: %v\n", err)
 		}
 
+		ClearTemporaryWake(cdo)
 		cdo.Spec.PowerState = "Hibernating"
+		RecordHistory(cdo, PowerEvent, "Hibernating by oplmgr sleep")
 
 		if err = client.Update(context.Background(), cdo); err != nil {
 			log.Printf("Unable to update cluster deployment powerState: %v\n", err)
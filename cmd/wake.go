@@ -18,11 +18,15 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	hivev1 "github.com/openshift/hive/apis/hive/v1"
 	"log"
+	"time"
 
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	runtimec "sigs.k8s.io/controller-runtime/pkg/client"
 
 	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
 )
@@ -30,7 +34,21 @@ import (
 var wakeCmd = &cobra.Command{
 	Use:   "wake",
 	Short: "Set powerState of Hive ClusterDeployment to Running",
-	Long:  ``,
+	Long: `oplmgr wake --clusterid b592ec70-487f-44fc-a389-80bbf111ec96
+oplmgr wake --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --for 2h
+
+Passing --for wakes the cluster for the given duration only. Hive's HibernateAfter puts the
+cluster back to sleep once it has passed. The regular HibernateAfter of the cluster is put back
+by the next "oplmgr schedule" run after the temporary wake is over, or the next time the cluster
+is woken or put to sleep.
+
+Clusters that slept for long often come back with pending kubelet certificate signing requests and
+nodes that stay NotReady. Passing --repair waits for Hive to report the cluster as Running, then
+connects with the admin kubeconfig, approves the pending CSRs of the cluster's own nodes until every
+node is Ready and warns about internal certificates that expired or are about to while the cluster
+was hibernating.
+
+oplmgr wake --clusterid b592ec70-487f-44fc-a389-80bbf111ec96 --repair --repair-timeout 45m`,
 	Run: func(cmd *cobra.Command, args []string) {
 		clusterid, err := cmd.Flags().GetString("clusterid")
 		if err != nil {
@@ -56,14 +74,138 @@ var wakeCmd = &cobra.Command{
 			log.Printf("Unable to get cluster deployment: %v\n", err)
 		}
 
-		cdo.Spec.PowerState = "Running"
+		if deleteat, pending := PendingDeletion(cdo); pending {
+			log.Fatalf("Cluster %v is pending deletion at %v; use oplmgr restore first\n", clusterid, deleteat.Format(time.RFC3339))
+		}
+
+		wakefor, err := cmd.Flags().GetDuration("for")
+		if err != nil {
+			log.Printf("Unable to get the for flag: %v\n", err)
+		}
+
+		var until time.Time
+		if wakefor > 0 {
+			until = SetTemporaryWake(cdo, wakefor)
+			RecordHistory(cdo, PowerEvent, "Running until "+until.Format(time.RFC3339)+" by oplmgr wake")
+		} else {
+			ClearTemporaryWake(cdo)
+			cdo.Spec.PowerState = "Running"
+			RecordHistory(cdo, PowerEvent, "Running by oplmgr wake")
+		}
+
+		repair, err := cmd.Flags().GetBool("repair")
+		if err != nil {
+			log.Printf("Unable to get the repair flag: %v\n", err)
+		}
+
+		repairtimeout, err := cmd.Flags().GetDuration("repair-timeout")
+		if err != nil {
+			log.Printf("Unable to get the repair-timeout flag: %v\n", err)
+		}
+
+		hibernatedsince, hibernated := HibernatingSince(cdo)
 
 		if err = client.Update(context.Background(), cdo); err != nil {
 			log.Printf("Unable to update cluster deployment powerState: %v\n", err)
+			return
+		}
+
+		if wakefor > 0 {
+			log.Printf("Cluster %v will hibernate again at %v\n", clusterid, until.Format(time.RFC3339))
+		}
+
+		if !repair {
+			return
+		}
+
+		deadline := time.Now().Add(repairtimeout)
+		if err = waitForRunning(client, cdt, repairtimeout); err != nil {
+			log.Fatalf("Unable to repair cluster %v: %v\n", clusterid, err)
 		}
+
+		k8sclient := K8sAuthenticate()
+		if err = client.Get(context.Background(), cdt, cdo); err != nil {
+			log.Fatalf("Unable to get cluster deployment: %v\n", err)
+		}
+
+		spoke, err := SpokeClientset(k8sclient, cdo)
+		if err != nil {
+			log.Fatalf("Unable to connect to cluster %v: %v\n", clusterid, err)
+		}
+
+		if !hibernated {
+			hibernatedsince = time.Now()
+		}
+		warnCertificateExpiry(spoke, clusterid, hibernatedsince)
+
+		approved, err := RepairNodes(context.Background(), spoke, time.Until(deadline), 20*time.Second)
+		if len(approved) > 0 {
+			log.Printf("Approved %d certificate signing requests of cluster %v\n", len(approved), clusterid)
+			detail := fmt.Sprintf("approved %d node certificate signing requests by oplmgr wake --repair", len(approved))
+			if err := recordEvent(client, cdt, PowerEvent, detail); err != nil {
+				log.Printf("Unable to record %v in the history of cluster %v: %v\n", detail, clusterid, err)
+			}
+		}
+		if err != nil {
+			log.Fatalf("Unable to repair cluster %v: %v\n", clusterid, err)
+		}
+
+		log.Printf("Every node of cluster %v is ready\n", clusterid)
 	},
 }
 
+// waitForRunning polls the ClusterDeployment until Hive reports the cluster as Running
+func waitForRunning(client runtimec.Client, cdt types.NamespacedName, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		cdo := &hivev1.ClusterDeployment{}
+		if err := client.Get(context.Background(), cdt, cdo); err != nil {
+			log.Printf("Unable to get cluster deployment: %v\n", err)
+		} else if HiveRunning(cdo) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v waiting for the cluster to be running", timeout)
+		}
+
+		time.Sleep(15 * time.Second)
+	}
+}
+
+// certificateWarning is how close to expiry an internal certificate has to be to warn about it
+const certificateWarning = 7 * 24 * time.Hour
+
+// warnCertificateExpiry logs the internal certificates that expired while the cluster was hibernating
+// or expire soon; operators can only rotate them while the cluster runs
+func warnCertificateExpiry(spoke *kubernetes.Clientset, clusterid string, hibernatedsince time.Time) {
+	expiries, err := CertificateExpiries(context.Background(), spoke)
+	if err != nil {
+		log.Printf("Unable to check the internal certificates of cluster %v: %v\n", clusterid, err)
+		return
+	}
+
+	now := time.Now()
+	for _, expiry := range expiries {
+		switch {
+		case expiry.NotAfter.Before(now) && expiry.NotAfter.After(hibernatedsince):
+			log.Printf("Warning: certificate %v of cluster %v expired at %v while the cluster was hibernating\n",
+				expiry.Secret, clusterid, expiry.NotAfter.Format(time.RFC3339))
+		case expiry.NotAfter.Before(now):
+			log.Printf("Warning: certificate %v of cluster %v expired at %v\n", expiry.Secret, clusterid, expiry.NotAfter.Format(time.RFC3339))
+		case expiry.NotAfter.Before(now.Add(certificateWarning)):
+			log.Printf("Warning: certificate %v of cluster %v expires at %v; keep the cluster running until it is rotated\n",
+				expiry.Secret, clusterid, expiry.NotAfter.Format(time.RFC3339))
+		}
+	}
+}
+
 func init() {
+	flags := wakeCmd.Flags()
+	flags.Duration("for", 0, "wake the cluster only for the given duration (e.g. 2h)")
+	flags.Bool("repair", false, "once running, approve pending node CSRs and wait for every node to be ready")
+	flags.Duration("repair-timeout", 30*time.Minute, "how long --repair waits for the cluster and its nodes")
+
 	rootCmd.AddCommand(wakeCmd)
 }
@@ -0,0 +1,308 @@
+/*
+Copyright © 2021 Melvin Hillsman <mrhillsman@redhat.com>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"golang.org/x/term"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+
+	. "github.com/redhat-openshift-partner-labs/oplmgr/internal"
+)
+
+const (
+	// recentTransition is how long a row stays highlighted after its power state or install phase changed
+	recentTransition = 2 * time.Minute
+
+	// redrawInterval refreshes the ages and highlights when no events arrive
+	redrawInterval = 15 * time.Second
+
+	// rewatchDelay is the first wait before watching again after a watch closed; it doubles up to
+	// maxRewatchDelay while watches keep closing right away
+	rewatchDelay    = time.Second
+	maxRewatchDelay = 30 * time.Second
+)
+
+var clusterDeploymentResource = schema.GroupVersionResource{
+	Group:    hivev1.SchemeGroupVersion.Group,
+	Version:  hivev1.SchemeGroupVersion.Version,
+	Resource: "clusterdeployments",
+}
+
+// watchedCluster is a row of the live table
+type watchedCluster struct {
+	Summary ClusterSummary
+	Changed time.Time
+}
+
+// status is what a transition is detected on
+func (c watchedCluster) status() string {
+	return c.Summary.State() + "/" + c.Summary.Install()
+}
+
+// clusterWatch keeps the rows of the live table up to date with the events of the watch
+type clusterWatch struct {
+	out      io.Writer
+	tty      bool
+	opts     infoOptions
+	clusters map[string]*watchedCluster
+	listed   bool
+}
+
+// watchClusters redraws a table of the clusters every time one of them changes until interrupted.
+// When out is not a terminal every change is printed as a line instead.
+func watchClusters(namespace string, clusterid string, opts infoOptions) error {
+	dc, err := DynamicClientK8sAuthenticate()
+	if err != nil {
+		return fmt.Errorf("unable to create dynamic client: %w", err)
+	}
+
+	selector, err := infoSelector(opts)
+	if err != nil {
+		return err
+	}
+
+	listopts := metav1.ListOptions{LabelSelector: selector.String()}
+	if clusterid != "" {
+		listopts.FieldSelector = "metadata.name=" + clusterid
+	}
+
+	w := &clusterWatch{
+		out:      os.Stdout,
+		tty:      term.IsTerminal(int(os.Stdout.Fd())),
+		opts:     opts,
+		clusters: make(map[string]*watchedCluster),
+	}
+
+	resource := dc.Resource(clusterDeploymentResource).Namespace(namespace)
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+
+	delay := rewatchDelay
+	for {
+		version, err := w.list(resource, listopts)
+		if err != nil {
+			return err
+		}
+
+		listopts.ResourceVersion = version
+		watcher, err := resource.Watch(context.Background(), listopts)
+		if err != nil {
+			return fmt.Errorf("unable to watch cluster deployments in namespace %v: %w", namespace, err)
+		}
+
+		started := time.Now()
+		w.follow(watcher, ticker)
+		watcher.Stop()
+		listopts.ResourceVersion = ""
+
+		// the API server closes watches after a while; list again so no change is missed, backing off
+		// when the watches keep failing right away
+		if time.Since(started) > maxRewatchDelay {
+			delay = rewatchDelay
+		}
+		if !w.tty {
+			log.Printf("Watch closed, resuming in %v\n", delay)
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRewatchDelay {
+			delay = maxRewatchDelay
+		}
+	}
+}
+
+// list loads every cluster, draws the table and returns the resource version to watch from
+func (w *clusterWatch) list(resource dynamic.ResourceInterface, listopts metav1.ListOptions) (string, error) {
+	list, err := resource.List(context.Background(), listopts)
+	if err != nil {
+		return "", fmt.Errorf("unable to list cluster deployments: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range list.Items {
+		if name := w.update(watch.Added, &list.Items[i]); name != "" {
+			seen[name] = true
+		}
+	}
+
+	for name := range w.clusters {
+		if !seen[name] {
+			delete(w.clusters, name)
+		}
+	}
+
+	w.listed = true
+	w.draw()
+
+	return list.GetResourceVersion(), nil
+}
+
+// follow handles the events of the watcher until it is closed
+func (w *clusterWatch) follow(watcher watch.Interface, ticker *time.Ticker) {
+	for {
+		select {
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+
+			obj, isobj := event.Object.(*unstructured.Unstructured)
+			if event.Type == watch.Error || !isobj {
+				return
+			}
+
+			if w.update(event.Type, obj) != "" {
+				w.draw()
+			}
+		case <-ticker.C:
+			if w.tty {
+				w.draw()
+			}
+		}
+	}
+}
+
+// update applies an event to the rows and returns the name of the cluster when it is shown
+func (w *clusterWatch) update(kind watch.EventType, obj *unstructured.Unstructured) string {
+	cd := hivev1.ClusterDeployment{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &cd); err != nil {
+		log.Printf("Unable to read cluster deployment %v: %v\n", obj.GetName(), err)
+		return ""
+	}
+
+	now := time.Now()
+	previous, known := w.clusters[cd.Name]
+
+	if kind == watch.Deleted || !matchesInfoFilters(&cd, w.opts, now) {
+		if known {
+			delete(w.clusters, cd.Name)
+			w.line("DELETED", previous)
+			return cd.Name
+		}
+		return ""
+	}
+
+	current := &watchedCluster{Summary: NewClusterSummary(&cd)}
+
+	switch {
+	case !known:
+		// clusters found by the first list are not new, only highlight the ones appearing later
+		if w.listed {
+			current.Changed = now
+		}
+		w.line("ADDED", current)
+	case previous.status() != current.status():
+		current.Changed = now
+		w.line("CHANGED", current)
+	default:
+		current.Changed = previous.Changed
+	}
+
+	w.clusters[cd.Name] = current
+
+	return cd.Name
+}
+
+// line prints a single change when the output is not a terminal
+func (w *clusterWatch) line(event string, cluster *watchedCluster) {
+	if w.tty {
+		return
+	}
+
+	summary := cluster.Summary
+	_, err := fmt.Fprintf(w.out, "%s %-7s %s company=%q region=%s state=%q install=%q\n", time.Now().Format(time.RFC3339),
+		event, summary.ClusterID, summary.Company, summary.Region, summary.State(), summary.Install())
+	if err != nil {
+		log.Printf("Unable to print cluster %v: %v\n", summary.ClusterID, err)
+	}
+}
+
+// draw clears the terminal and prints the table, highlighting recently changed rows
+func (w *clusterWatch) draw() {
+	if !w.tty {
+		return
+	}
+
+	names := make([]string, 0, len(w.clusters))
+	for name := range w.clusters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	var b strings.Builder
+
+	// move to the top left and clear the screen
+	b.WriteString("\033[H\033[2J")
+	fmt.Fprintf(&b, "%d clusters, updated %s\n\n", len(names), now.Format("15:04:05"))
+
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tCOMPANY\tREGION\tSTATE\tINSTALL\tAGE")
+	for _, name := range names {
+		cluster := w.clusters[name]
+		summary := cluster.Summary
+
+		marker := " "
+		if now.Sub(cluster.Changed) < recentTransition {
+			marker = "*"
+		}
+
+		fmt.Fprintf(tw, "%s %s\t%s\t%s\t%s\t%s\t%s\n", marker, summary.ClusterID, dash(summary.Company),
+			dash(summary.Region), summary.State(), summary.Install(), duration.HumanDuration(now.Sub(summary.Created)))
+	}
+	if err := tw.Flush(); err != nil {
+		log.Printf("Unable to draw the cluster table: %v\n", err)
+		return
+	}
+
+	// escape codes would throw off the alignment of tabwriter so rows are highlighted after it ran
+	lines := strings.Split(b.String(), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "* ") {
+			lines[i] = "\033[1;33m" + line + "\033[0m"
+		}
+	}
+
+	if _, err := io.WriteString(w.out, strings.Join(lines, "\n")); err != nil {
+		log.Printf("Unable to draw the cluster table: %v\n", err)
+	}
+}
+
+// dash stands in for empty cells
+func dash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"golang.org/x/crypto/pbkdf2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ArchiveExtension is the extension of the encrypted tarballs written by ArchiveLab
+	ArchiveExtension = ".tar.gz.enc"
+
+	// archiveTimeFormat is the UTC time in the name of an archive, down to the nanosecond so a lab
+	// archived twice in a row gets two archives
+	archiveTimeFormat = "20060102T150405.000000000Z"
+
+	archiveIterations = 100000
+	archiveSaltSize   = 16
+)
+
+// sensitiveKeys are never copied from the lab secret into an archive
+var sensitiveKeys = []string{"password", "secret", "token", "key", "kubeconfig", "install-config", "pull"}
+
+// LabArchive is everything kept about a lab once it is deleted. It never contains credentials; secrets
+// are only referenced by name in the spec.
+type LabArchive struct {
+	ClusterID   string                         `json:"clusterID"`
+	Company     string                         `json:"company"`
+	Reason      string                         `json:"reason"`
+	ArchivedAt  time.Time                      `json:"archivedAt"`
+	Labels      map[string]string              `json:"labels"`
+	Annotations map[string]string              `json:"annotations"`
+	Spec        hivev1.ClusterDeploymentSpec   `json:"spec"`
+	Status      hivev1.ClusterDeploymentStatus `json:"status"`
+	Request     map[string]string              `json:"request"`
+	History     []HistoryEvent                 `json:"history"`
+}
+
+// NewLabArchive collects the archive record of a lab; the ClusterDeployment, the non sensitive keys
+// of the lab secret holding the request and the lab's history
+func NewLabArchive(k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment, reason string) (*LabArchive, error) {
+	annotations := make(map[string]string)
+	for key, value := range cd.Annotations {
+		if key != HistoryAnnotation {
+			annotations[key] = value
+		}
+	}
+
+	archive := &LabArchive{
+		ClusterID:   cd.Name,
+		Company:     cd.Annotations[CompanyAnnotation],
+		Reason:      reason,
+		ArchivedAt:  time.Now().UTC(),
+		Labels:      cd.Labels,
+		Annotations: annotations,
+		Spec:        cd.Spec,
+		Status:      cd.Status,
+		Request:     make(map[string]string),
+		History:     History(cd),
+	}
+
+	labsecret, err := k8sclient.CoreV1().Secrets(cd.Namespace).Get(context.Background(), cd.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("unable to get the lab secret of %v: %w", cd.Name, err)
+	}
+	if err == nil {
+		for key, value := range labsecret.Data {
+			if !sensitive(key) {
+				archive.Request[key] = string(value)
+			}
+		}
+	}
+
+	return archive, nil
+}
+
+// ArchiveLab writes the archive as an encrypted tarball to dir and returns its path. The tarball
+// holds clusterdeployment.json, request.json and history.json.
+func ArchiveLab(dir string, passphrase string, archive *LabArchive) (string, error) {
+	if passphrase == "" {
+		return "", fmt.Errorf("no archive key set")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("unable to create archive directory %v: %w", dir, err)
+	}
+
+	cdrecord := *archive
+	cdrecord.Request = nil
+	cdrecord.History = nil
+
+	files := map[string]interface{}{
+		"clusterdeployment.json": cdrecord,
+		"request.json":           archive.Request,
+		"history.json":           archive.History,
+	}
+
+	var tarball bytes.Buffer
+	gz := gzip.NewWriter(&tarball)
+	tw := tar.NewWriter(gz)
+
+	for _, name := range []string{"clusterdeployment.json", "request.json", "history.json"} {
+		data, err := json.MarshalIndent(files[name], "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("unable to marshal %v of %v: %w", name, archive.ClusterID, err)
+		}
+
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: archive.ArchivedAt}
+		if err = tw.WriteHeader(header); err != nil {
+			return "", err
+		}
+		if _, err = tw.Write(data); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+
+	sealed, err := sealArchive(passphrase, tarball.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("unable to encrypt archive of %v: %w", archive.ClusterID, err)
+	}
+
+	// two archives of a lab never share a name, and an existing archive is never overwritten
+	path := filepath.Join(dir, archive.ClusterID+"-"+archive.ArchivedAt.Format(archiveTimeFormat)+ArchiveExtension)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("unable to create archive %v: %w", path, err)
+	}
+
+	if _, err = file.Write(sealed); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("unable to write archive %v: %w", path, err)
+	}
+
+	if err = file.Close(); err != nil {
+		return "", fmt.Errorf("unable to write archive %v: %w", path, err)
+	}
+
+	return path, nil
+}
+
+// ReadLabArchive decrypts and unpacks an archive written by ArchiveLab
+func ReadLabArchive(path string, passphrase string) (*LabArchive, error) {
+	sealed, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read archive %v: %w", path, err)
+	}
+
+	data, err := openArchive(passphrase, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt archive %v: %w", path, err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to uncompress archive %v: %w", path, err)
+	}
+
+	archive := &LabArchive{}
+	tr := tar.NewReader(gz)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read archive %v: %w", path, err)
+		}
+
+		var target interface{}
+		switch header.Name {
+		case "clusterdeployment.json":
+			target = archive
+		case "request.json":
+			target = &archive.Request
+		case "history.json":
+			target = &archive.History
+		default:
+			continue
+		}
+
+		if err = json.NewDecoder(tr).Decode(target); err != nil {
+			return nil, fmt.Errorf("unable to parse %v in archive %v: %w", header.Name, path, err)
+		}
+	}
+
+	return archive, nil
+}
+
+// ListArchives returns the archives in dir, oldest first. An empty clusterid returns every archive.
+func ListArchives(dir string, clusterid string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read archive directory %v: %w", dir, err)
+	}
+
+	prefix := ""
+	if clusterid != "" {
+		prefix = clusterid + "-"
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ArchiveExtension) || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+
+	// names end with the UTC time of the archive so sorting on it orders them in time
+	sort.Slice(paths, func(i, j int) bool {
+		return archiveTime(paths[i]) < archiveTime(paths[j])
+	})
+
+	return paths, nil
+}
+
+func archiveTime(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ArchiveExtension)
+	return name[strings.LastIndex(name, "-")+1:]
+}
+
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range sensitiveKeys {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sealArchive encrypts data with AES-256-GCM using a key derived from the passphrase. The salt and
+// nonce are written in front of the ciphertext.
+func sealArchive(passphrase string, data []byte) ([]byte, error) {
+	salt := make([]byte, archiveSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := archiveCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := append(salt, nonce...)
+
+	return gcm.Seal(sealed, nonce, data, nil), nil
+}
+
+func openArchive(passphrase string, sealed []byte) ([]byte, error) {
+	if len(sealed) < archiveSaltSize {
+		return nil, fmt.Errorf("archive is too short")
+	}
+
+	gcm, err := archiveCipher(passphrase, sealed[:archiveSaltSize])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed = sealed[archiveSaltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("archive is too short")
+	}
+
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+func archiveCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2.Key([]byte(passphrase), salt, archiveIterations, 32, sha256.New)
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(c)
+}
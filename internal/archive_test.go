@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestArchiveEncryption(t *testing.T) {
+	tests := []struct {
+		name    string
+		seal    string
+		open    string
+		data    []byte
+		corrupt bool
+		ok      bool
+	}{
+		{"round trip", "passphrase", "passphrase", []byte("lab record"), false, true},
+		{"empty data", "passphrase", "passphrase", []byte{}, false, true},
+		{"wrong key", "passphrase", "other passphrase", []byte("lab record"), false, false},
+		{"tampered ciphertext", "passphrase", "passphrase", []byte("lab record"), true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sealed, err := sealArchive(test.seal, test.data)
+			if err != nil {
+				t.Fatalf("unable to seal: %v", err)
+			}
+
+			if bytes.Contains(sealed, []byte("lab record")) {
+				t.Errorf("sealed archive holds the plain text")
+			}
+
+			if test.corrupt {
+				sealed[len(sealed)-1] ^= 0xff
+			}
+
+			opened, err := openArchive(test.open, sealed)
+			if !test.ok {
+				if err == nil {
+					t.Errorf("expected opening to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unable to open: %v", err)
+			}
+			if !bytes.Equal(opened, test.data) {
+				t.Errorf("got %q, want %q", opened, test.data)
+			}
+		})
+	}
+}
+
+func TestOpenArchiveTooShort(t *testing.T) {
+	for _, size := range []int{0, archiveSaltSize - 1, archiveSaltSize + 4} {
+		if _, err := openArchive("passphrase", make([]byte, size)); err == nil {
+			t.Errorf("expected an error opening %d bytes", size)
+		}
+	}
+}
+
+func TestSensitive(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"primaryContactEmail", false},
+		{"companyName", false},
+		{"redHatSponsor", false},
+		{"kubeadminPassword", true},
+		{"PASSWORD", true},
+		{"clientSecret", true},
+		{"githubToken", true},
+		{"sshKey", true},
+		{"kubeconfig", true},
+		{"install-config.yaml", true},
+		{"pullSecret", true},
+	}
+
+	for _, test := range tests {
+		if got := sensitive(test.key); got != test.want {
+			t.Errorf("sensitive(%q) = %v, want %v", test.key, got, test.want)
+		}
+	}
+}
+
+func TestArchiveLab(t *testing.T) {
+	dir := t.TempDir()
+	archive := &LabArchive{
+		ClusterID:  "b592ec70-487f-44fc-a389-80bbf111ec96",
+		Company:    "Acme",
+		Reason:     "lease ended",
+		ArchivedAt: time.Date(2021, 10, 14, 9, 0, 0, 0, time.UTC),
+		Request:    map[string]string{"companyName": "Acme"},
+	}
+
+	if _, err := ArchiveLab(dir, "", archive); err == nil {
+		t.Errorf("expected an error without an archive key")
+	}
+
+	path, err := ArchiveLab(dir, "passphrase", archive)
+	if err != nil {
+		t.Fatalf("unable to archive: %v", err)
+	}
+
+	// a second archive of the same lab at the same time must not overwrite the first
+	if _, err = ArchiveLab(dir, "passphrase", archive); err == nil {
+		t.Errorf("expected an error instead of overwriting %v", path)
+	}
+
+	later := *archive
+	later.ArchivedAt = archive.ArchivedAt.Add(time.Millisecond)
+	if _, err = ArchiveLab(dir, "passphrase", &later); err != nil {
+		t.Errorf("unable to archive again within the same second: %v", err)
+	}
+
+	read, err := ReadLabArchive(path, "passphrase")
+	if err != nil {
+		t.Fatalf("unable to read archive: %v", err)
+	}
+	if read.ClusterID != archive.ClusterID || read.Reason != archive.Reason || read.Request["companyName"] != "Acme" {
+		t.Errorf("read back %+v, want %+v", read, archive)
+	}
+
+	if _, err = ReadLabArchive(path, "wrong"); err == nil {
+		t.Errorf("expected an error reading the archive with the wrong key")
+	}
+
+	paths, err := ListArchives(dir, archive.ClusterID)
+	if err != nil {
+		t.Fatalf("unable to list archives: %v", err)
+	}
+	if len(paths) != 2 || paths[0] != path {
+		t.Errorf("got archives %v, want %v first of two", paths, path)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if paths, _ = ListArchives(dir, ""); len(paths) != 2 {
+		t.Errorf("got archives %v, want only the two archives", paths)
+	}
+}
@@ -0,0 +1,477 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// WeekendHibernationLabel lets a lab opt out of hibernating on weekends and holidays when set to "false"
+const WeekendHibernationLabel = "opl-weekend-hibernation"
+
+// Calendar holds the working days, hours and holidays for each region a lab can be assigned to
+type Calendar struct {
+	Regions map[string]*RegionCalendar `json:"regions"`
+}
+
+// RegionCalendar describes when clusters of a single region are expected to be in use. Holidays are
+// dates in the 2006-01-02 format and ICal is an optional path to an iCalendar file with more holidays.
+type RegionCalendar struct {
+	Location string   `json:"location"`
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Workdays []string `json:"workdays"`
+	Holidays []string `json:"holidays"`
+	ICal     string   `json:"ical"`
+
+	location *time.Location
+	start    time.Duration
+	end      time.Duration
+	workdays map[time.Weekday]bool
+	holidays map[string]bool
+}
+
+// DefaultCalendar matches the availability promised in the welcome email; 9am to 5pm, Monday to Friday
+func DefaultCalendar() *Calendar {
+	workdays := []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"}
+
+	return &Calendar{
+		Regions: map[string]*RegionCalendar{
+			"americas": {Location: "America/Panama", Start: "09:00", End: "17:00", Workdays: workdays},
+			"emea":     {Location: "Africa/Algiers", Start: "09:00", End: "17:00", Workdays: workdays},
+			"apac":     {Location: "Asia/Jakarta", Start: "09:00", End: "17:00", Workdays: workdays},
+		},
+	}
+}
+
+// LoadCalendar reads a YAML calendar from path. Regions missing from the file, and fields missing
+// from a region, fall back to the default calendar.
+func LoadCalendar(path string) (*Calendar, error) {
+	calendar := DefaultCalendar()
+
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read calendar %v: %w", path, err)
+		}
+
+		custom := Calendar{}
+		if err = yaml.Unmarshal(data, &custom); err != nil {
+			return nil, fmt.Errorf("unable to parse calendar %v: %w", path, err)
+		}
+
+		for name, region := range custom.Regions {
+			if defaults, ok := calendar.Regions[name]; ok {
+				region.withDefaults(defaults)
+			}
+			calendar.Regions[name] = region
+		}
+	}
+
+	for name, region := range calendar.Regions {
+		if err := region.compile(); err != nil {
+			return nil, fmt.Errorf("invalid calendar for region %v: %w", name, err)
+		}
+	}
+
+	return calendar, nil
+}
+
+// Region returns the calendar for the region the cluster was requested in
+func (c *Calendar) Region(cd *hivev1.ClusterDeployment) (*RegionCalendar, error) {
+	name := LabRegion(cd)
+	if name == "" {
+		return nil, fmt.Errorf("cluster %v has neither an %v nor a %v label", cd.Name, RegionLabel, TimezoneLabel)
+	}
+
+	region, ok := c.Regions[name]
+	if !ok {
+		return nil, fmt.Errorf("no calendar for region %v", name)
+	}
+
+	return region, nil
+}
+
+// ShouldRun reports whether the cluster is expected to be running at t
+func (c *Calendar) ShouldRun(cd *hivev1.ClusterDeployment, t time.Time) (bool, error) {
+	region, err := c.Region(cd)
+	if err != nil {
+		return false, err
+	}
+
+	if cd.Labels[WeekendHibernationLabel] == "false" {
+		return region.InHours(t), nil
+	}
+
+	return region.IsWorkday(t) && region.InHours(t), nil
+}
+
+// NextHibernation returns when a running cluster is next due to hibernate; at the end of a temporary
+// wake or at the end of the working hours of its region
+func (c *Calendar) NextHibernation(cd *hivev1.ClusterDeployment, t time.Time) (time.Time, bool) {
+	if until, ok := TemporaryWakeDeadline(cd); ok && t.Before(until) {
+		return until, true
+	}
+
+	run, err := c.ShouldRun(cd, t)
+	if err != nil || !run {
+		return time.Time{}, false
+	}
+
+	region, err := c.Region(cd)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return region.EndOfHours(t), true
+}
+
+// Zone returns the timezone the region's working hours are in
+func (r *RegionCalendar) Zone() *time.Location {
+	return r.location
+}
+
+// EndOfHours returns the end of the working hours on the day of t
+func (r *RegionCalendar) EndOfHours(t time.Time) time.Time {
+	local := t.In(r.location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, r.location)
+
+	return midnight.Add(r.end)
+}
+
+// IsWorkday reports whether t falls on a working day that is not a holiday in the region
+func (r *RegionCalendar) IsWorkday(t time.Time) bool {
+	local := t.In(r.location)
+	return r.workdays[local.Weekday()] && !r.holidays[local.Format("2006-01-02")]
+}
+
+// InHours reports whether t falls within the region's daily working hours
+func (r *RegionCalendar) InHours(t time.Time) bool {
+	local := t.In(r.location)
+	clock := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute
+
+	return clock >= r.start && clock < r.end
+}
+
+func (r *RegionCalendar) withDefaults(defaults *RegionCalendar) {
+	if r.Location == "" {
+		r.Location = defaults.Location
+	}
+	if r.Start == "" {
+		r.Start = defaults.Start
+	}
+	if r.End == "" {
+		r.End = defaults.End
+	}
+	if r.Workdays == nil {
+		r.Workdays = defaults.Workdays
+	}
+}
+
+func (r *RegionCalendar) compile() error {
+	var err error
+
+	if r.location, err = time.LoadLocation(r.Location); err != nil {
+		return err
+	}
+	if r.start, err = parseClock(r.Start); err != nil {
+		return err
+	}
+	if r.end, err = parseClock(r.End); err != nil {
+		return err
+	}
+	if r.end <= r.start {
+		return fmt.Errorf("working hours %v to %v end before they start; hours past midnight are not supported", r.Start, r.End)
+	}
+
+	r.workdays = make(map[time.Weekday]bool)
+	for _, day := range r.Workdays {
+		weekday, err := parseWeekday(day)
+		if err != nil {
+			return err
+		}
+		r.workdays[weekday] = true
+	}
+
+	r.holidays = make(map[string]bool)
+	for _, holiday := range r.Holidays {
+		if _, err := time.Parse("2006-01-02", holiday); err != nil {
+			return fmt.Errorf("invalid holiday %q: %w", holiday, err)
+		}
+		r.holidays[holiday] = true
+	}
+
+	if r.ICal != "" {
+		dates, err := readICalDates(r.ICal)
+		if err != nil {
+			return err
+		}
+		for _, date := range dates {
+			r.holidays[date] = true
+		}
+	}
+
+	return nil
+}
+
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q: %w", clock, err)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func parseWeekday(day string) (time.Weekday, error) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		name := weekday.String()
+		if strings.EqualFold(day, name) || strings.EqualFold(day, name[:3]) {
+			return weekday, nil
+		}
+	}
+
+	return time.Sunday, fmt.Errorf("invalid weekday %q", day)
+}
+
+// icalHorizon is how many years past the current one yearly recurring holidays are expanded
+const icalHorizon = 5
+
+// readICalDates returns every date covered by an event in an iCalendar file. Events spanning several
+// days are expanded up to their DTEND or DURATION and yearly RRULEs up to icalHorizon years ahead.
+// Other recurrences cannot be expanded here and are rejected rather than silently ignored.
+func readICalDates(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open ical file %v: %w", path, err)
+	}
+	defer func(file *os.File) {
+		err := file.Close()
+		if err != nil {
+			log.Printf("Unable to close ical file: %v\n", err)
+		}
+	}(file)
+
+	lines, err := unfoldICal(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ical file %v: %w", path, err)
+	}
+
+	var dates []string
+	var event map[string]string
+
+	for _, line := range lines {
+		switch {
+		case line == "BEGIN:VEVENT":
+			event = map[string]string{}
+		case line == "END:VEVENT":
+			if event == nil {
+				continue
+			}
+			eventdates, err := icalEventDates(event, time.Now().Year()+icalHorizon)
+			if err != nil {
+				return nil, fmt.Errorf("invalid event %q in ical file %v: %w", event["SUMMARY"], path, err)
+			}
+			dates = append(dates, eventdates...)
+			event = nil
+		case event != nil:
+			// DTSTART;VALUE=DATE:20211225 has the name DTSTART and the value 20211225
+			colon := strings.Index(line, ":")
+			if colon < 0 {
+				continue
+			}
+			name := line[:colon]
+			if semicolon := strings.Index(name, ";"); semicolon >= 0 {
+				name = name[:semicolon]
+			}
+			event[strings.ToUpper(name)] = line[colon+1:]
+		}
+	}
+
+	return dates, nil
+}
+
+// unfoldICal returns the lines of an iCalendar file with long lines that were folded joined again
+func unfoldICal(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+
+	return lines, scanner.Err()
+}
+
+// icalEventDates returns the dates covered by a single event and its yearly recurrences until the
+// end of the year lastyear
+func icalEventDates(event map[string]string, lastyear int) ([]string, error) {
+	value, ok := event["DTSTART"]
+	if !ok {
+		return nil, fmt.Errorf("no DTSTART")
+	}
+
+	start, _, err := parseICalDate(value)
+	if err != nil {
+		return nil, err
+	}
+
+	days := 1
+	if value, ok := event["DTEND"]; ok {
+		end, endclock, err := parseICalDate(value)
+		if err != nil {
+			return nil, err
+		}
+		// a DTEND date is exclusive, a DTEND date-time only when it is midnight
+		days = int(end.Sub(start).Hours() / 24)
+		if endclock && !strings.HasPrefix(value[8:], "T000000") {
+			days++
+		}
+	} else if value, ok := event["DURATION"]; ok {
+		if days, err = parseICalDays(value); err != nil {
+			return nil, err
+		}
+	}
+	if days < 1 {
+		days = 1
+	}
+
+	for _, property := range []string{"RDATE", "EXDATE"} {
+		if _, ok := event[property]; ok {
+			return nil, fmt.Errorf("%v is not supported", property)
+		}
+	}
+
+	occurrences := []time.Time{start}
+	if rule, ok := event["RRULE"]; ok {
+		if occurrences, err = expandYearly(start, rule, lastyear); err != nil {
+			return nil, err
+		}
+	}
+
+	var dates []string
+	for _, occurrence := range occurrences {
+		for day := 0; day < days; day++ {
+			dates = append(dates, occurrence.AddDate(0, 0, day).Format("2006-01-02"))
+		}
+	}
+
+	return dates, nil
+}
+
+// parseICalDate returns the date of a DATE (20211225) or DATE-TIME (20211225T090000Z) value and
+// whether it had a time of day
+func parseICalDate(value string) (time.Time, bool, error) {
+	if len(value) < 8 {
+		return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+	}
+
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date %q: %w", value, err)
+	}
+
+	return date, len(value) > 8, nil
+}
+
+// parseICalDays returns the number of days of a DURATION in whole days or weeks, e.g. P2D or P1W
+func parseICalDays(value string) (int, error) {
+	if len(value) < 3 || !strings.HasPrefix(value, "P") {
+		return 0, fmt.Errorf("unsupported duration %q", value)
+	}
+
+	unit := map[string]int{"D": 1, "W": 7}[value[len(value)-1:]]
+	if unit == 0 {
+		return 0, fmt.Errorf("unsupported duration %q", value)
+	}
+
+	n, err := strconv.Atoi(value[1 : len(value)-1])
+	if err != nil {
+		return 0, fmt.Errorf("unsupported duration %q", value)
+	}
+
+	return n * unit, nil
+}
+
+// expandYearly returns the occurrences of a yearly RRULE starting at start until the end of lastyear.
+// Only FREQ=YEARLY with INTERVAL, COUNT, UNTIL and a BYMONTH/BYMONTHDAY matching DTSTART is
+// supported; rules that move the date, e.g. BYDAY=4TH, are rejected.
+func expandYearly(start time.Time, rule string, lastyear int) ([]time.Time, error) {
+	interval, count := 1, 0
+	until := time.Date(lastyear, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+	for _, part := range strings.Split(rule, ";") {
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid RRULE %q", rule)
+		}
+
+		var err error
+		switch strings.ToUpper(kv[0]) {
+		case "FREQ":
+			if !strings.EqualFold(kv[1], "YEARLY") {
+				return nil, fmt.Errorf("RRULE %q is not supported, only FREQ=YEARLY is", rule)
+			}
+		case "INTERVAL":
+			if interval, err = strconv.Atoi(kv[1]); err != nil || interval < 1 {
+				return nil, fmt.Errorf("invalid RRULE %q", rule)
+			}
+		case "COUNT":
+			if count, err = strconv.Atoi(kv[1]); err != nil || count < 1 {
+				return nil, fmt.Errorf("invalid RRULE %q", rule)
+			}
+		case "UNTIL":
+			end, _, err := parseICalDate(kv[1])
+			if err != nil {
+				return nil, err
+			}
+			if end.Before(until) {
+				until = end
+			}
+		case "BYMONTH":
+			if kv[1] != strconv.Itoa(int(start.Month())) {
+				return nil, fmt.Errorf("RRULE %q is not supported, BYMONTH must match DTSTART", rule)
+			}
+		case "BYMONTHDAY":
+			if kv[1] != strconv.Itoa(start.Day()) {
+				return nil, fmt.Errorf("RRULE %q is not supported, BYMONTHDAY must match DTSTART", rule)
+			}
+		case "WKST":
+		default:
+			return nil, fmt.Errorf("RRULE %q is not supported, %v cannot be expanded", rule, kv[0])
+		}
+	}
+
+	var occurrences []time.Time
+	for year := 0; ; year += interval {
+		occurrence := start.AddDate(year, 0, 0)
+		if occurrence.After(until) || (count > 0 && len(occurrences) == count) {
+			break
+		}
+		// February 29 only recurs in leap years
+		if occurrence.Day() != start.Day() {
+			continue
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+
+	return occurrences, nil
+}
@@ -0,0 +1,218 @@
+package internal
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestShouldRun(t *testing.T) {
+	path := writeFile(t, "calendar.yaml", `
+regions:
+  emea:
+    location: Europe/Berlin
+    start: "08:00"
+    end: "18:00"
+    holidays: ["2021-12-24"]
+`)
+
+	calendar, err := LoadCalendar(path)
+	if err != nil {
+		t.Fatalf("unable to load calendar: %v", err)
+	}
+
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	jakarta, _ := time.LoadLocation("Asia/Jakarta")
+
+	tests := []struct {
+		name   string
+		labels map[string]string
+		at     time.Time
+		want   bool
+		err    bool
+	}{
+		{"working hours", map[string]string{"timezone": "emea"}, time.Date(2021, 12, 22, 9, 0, 0, 0, berlin), true, false},
+		{"before start", map[string]string{"timezone": "emea"}, time.Date(2021, 12, 22, 7, 59, 0, 0, berlin), false, false},
+		{"at the end", map[string]string{"timezone": "emea"}, time.Date(2021, 12, 22, 18, 0, 0, 0, berlin), false, false},
+		{"other timezone", map[string]string{"timezone": "emea"}, time.Date(2021, 12, 22, 15, 0, 0, 0, jakarta), true, false},
+		{"weekend", map[string]string{"timezone": "emea"}, time.Date(2021, 12, 25, 9, 0, 0, 0, berlin), false, false},
+		{"holiday", map[string]string{"timezone": "emea"}, time.Date(2021, 12, 24, 9, 0, 0, 0, berlin), false, false},
+		{"weekend opted out", map[string]string{"timezone": "emea", WeekendHibernationLabel: "false"}, time.Date(2021, 12, 25, 9, 0, 0, 0, berlin), true, false},
+		{"default region", map[string]string{"timezone": "apac"}, time.Date(2021, 12, 22, 10, 0, 0, 0, jakarta), true, false},
+		{"unknown region", map[string]string{"timezone": "mars"}, time.Date(2021, 12, 22, 9, 0, 0, 0, berlin), false, true},
+		{"region label", map[string]string{RegionLabel: "emea"}, time.Date(2021, 12, 22, 9, 0, 0, 0, berlin), true, false},
+		{"region label wins", map[string]string{RegionLabel: "emea", "timezone": "apac"}, time.Date(2021, 12, 22, 7, 59, 0, 0, berlin), false, false},
+		{"no region", nil, time.Date(2021, 12, 22, 9, 0, 0, 0, berlin), false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cd := &hivev1.ClusterDeployment{ObjectMeta: metav1.ObjectMeta{Name: "lab", Labels: test.labels}}
+
+			got, err := calendar.ShouldRun(cd, test.at)
+			if test.err != (err != nil) {
+				t.Fatalf("got error %v, want error %v", err, test.err)
+			}
+			if got != test.want {
+				t.Errorf("ShouldRun = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadCalendarErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		calendar string
+		err      string
+	}{
+		{"end before start", "regions:\n  emea:\n    start: \"18:00\"\n    end: \"08:00\"\n", "end before they start"},
+		{"same start and end", "regions:\n  emea:\n    start: \"09:00\"\n    end: \"09:00\"\n", "end before they start"},
+		{"invalid time", "regions:\n  emea:\n    start: \"9am\"\n", "invalid time of day"},
+		{"invalid weekday", "regions:\n  emea:\n    workdays: [Funday]\n", "invalid weekday"},
+		{"invalid holiday", "regions:\n  emea:\n    holidays: [\"24.12.2021\"]\n", "invalid holiday"},
+		{"unknown location", "regions:\n  emea:\n    location: Nowhere/City\n", "unknown time zone"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := LoadCalendar(writeFile(t, "calendar.yaml", test.calendar))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestICalEventDates(t *testing.T) {
+	tests := []struct {
+		name  string
+		event map[string]string
+		want  []string
+		err   bool
+	}{
+		{
+			name:  "single day",
+			event: map[string]string{"DTSTART": "20211224"},
+			want:  []string{"2021-12-24"},
+		},
+		{
+			name:  "date time",
+			event: map[string]string{"DTSTART": "20211224T090000Z"},
+			want:  []string{"2021-12-24"},
+		},
+		{
+			name:  "exclusive DTEND date",
+			event: map[string]string{"DTSTART": "20211224", "DTEND": "20211227"},
+			want:  []string{"2021-12-24", "2021-12-25", "2021-12-26"},
+		},
+		{
+			name:  "DTEND date time during the last day",
+			event: map[string]string{"DTSTART": "20211224T090000", "DTEND": "20211225T170000"},
+			want:  []string{"2021-12-24", "2021-12-25"},
+		},
+		{
+			name:  "DTEND at midnight",
+			event: map[string]string{"DTSTART": "20211224T000000", "DTEND": "20211226T000000"},
+			want:  []string{"2021-12-24", "2021-12-25"},
+		},
+		{
+			name:  "duration",
+			event: map[string]string{"DTSTART": "20211224", "DURATION": "P2D"},
+			want:  []string{"2021-12-24", "2021-12-25"},
+		},
+		{
+			name:  "yearly",
+			event: map[string]string{"DTSTART": "20211225", "RRULE": "FREQ=YEARLY"},
+			want:  []string{"2021-12-25", "2022-12-25", "2023-12-25"},
+		},
+		{
+			name:  "yearly with count and matching month day",
+			event: map[string]string{"DTSTART": "20211225", "RRULE": "FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=25;COUNT=2"},
+			want:  []string{"2021-12-25", "2022-12-25"},
+		},
+		{
+			name:  "yearly until",
+			event: map[string]string{"DTSTART": "20201225", "RRULE": "FREQ=YEARLY;UNTIL=20211231T000000Z"},
+			want:  []string{"2020-12-25", "2021-12-25"},
+		},
+		{
+			name:  "yearly multi-day",
+			event: map[string]string{"DTSTART": "20211224", "DTEND": "20211226", "RRULE": "FREQ=YEARLY;INTERVAL=2"},
+			want:  []string{"2021-12-24", "2021-12-25", "2023-12-24", "2023-12-25"},
+		},
+		{
+			name:  "leap day",
+			event: map[string]string{"DTSTART": "20200229", "RRULE": "FREQ=YEARLY"},
+			want:  []string{"2020-02-29"},
+		},
+		{name: "no DTSTART", event: map[string]string{"SUMMARY": "Holiday"}, err: true},
+		{name: "monthly", event: map[string]string{"DTSTART": "20211201", "RRULE": "FREQ=MONTHLY"}, err: true},
+		{name: "by day", event: map[string]string{"DTSTART": "20211125", "RRULE": "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH"}, err: true},
+		{name: "exdate", event: map[string]string{"DTSTART": "20211225", "RRULE": "FREQ=YEARLY", "EXDATE": "20221225"}, err: true},
+		{name: "hour duration", event: map[string]string{"DTSTART": "20211224", "DURATION": "PT8H"}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := icalEventDates(test.event, 2023)
+			if test.err {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadICalDates(t *testing.T) {
+	path := writeFile(t, "holidays.ics", strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"SUMMARY:Christmas",
+		"DTSTART;VALUE=DATE:20211224",
+		"DTEND;VALUE=DATE:20211227",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:New Year",
+		"DTSTART;VALUE=DATE:20220101",
+		"RRULE:FREQ=YEARLY;",
+		" COUNT=2",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n"))
+
+	got, err := readICalDates(path)
+	if err != nil {
+		t.Fatalf("unable to read ical file: %v", err)
+	}
+
+	want := []string{"2021-12-24", "2021-12-25", "2021-12-26", "2022-01-01", "2023-01-01"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
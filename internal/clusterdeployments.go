@@ -2,17 +2,119 @@ package internal
 
 import (
 	"context"
+	"fmt"
 	hivev1 "github.com/openshift/hive/apis/hive/v1"
 	"github.com/openshift/hive/apis/hive/v1/aws"
 	"log"
+	netmail "net/mail"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+const (
+	// CompanyAnnotation records the company that requested the lab
+	CompanyAnnotation = "opl-company"
+
+	// PrimaryContactAnnotation records the email address of the lab's primary contact
+	PrimaryContactAnnotation = "opl-primary-contact"
+
+	// SecondaryContactAnnotation records the email address of the lab's secondary contact
+	SecondaryContactAnnotation = "opl-secondary-contact"
+
+	// SponsorAnnotation records the Red Hat sponsor of the lab
+	SponsorAnnotation = "opl-sponsor"
+
+	// SponsorContactAnnotation records the email address of the lab's Red Hat sponsor
+	SponsorContactAnnotation = "opl-sponsor-contact"
+
+	// ProtectedLabel prevents a cluster from being deleted when set to "true"
+	ProtectedLabel = "opl-protected"
+
+	// RegionLabel records the region the lab was requested in
+	RegionLabel = "opl-region"
+
+	// TimezoneLabel records the region of labs created before RegionLabel was set
+	TimezoneLabel = "timezone"
+)
+
+// LabRegion returns the region the lab was requested in, falling back to the timezone label of older labs
+func LabRegion(cd *hivev1.ClusterDeployment) string {
+	if region := cd.Labels[RegionLabel]; region != "" {
+		return region
+	}
+
+	return cd.Labels[TimezoneLabel]
+}
+
+// Contacts are the email addresses of the people emails about a lab go to
+type Contacts struct {
+	Primary   string
+	Secondary string
+	Sponsor   string
+}
+
+// LabContacts returns the contacts recorded on the cluster at provision time. Labs provisioned before
+// contacts were recorded fall back to the request kept in the lab secret.
+func LabContacts(k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment) (Contacts, error) {
+	contacts := Contacts{
+		Primary:   cd.Annotations[PrimaryContactAnnotation],
+		Secondary: cd.Annotations[SecondaryContactAnnotation],
+		Sponsor:   cd.Annotations[SponsorContactAnnotation],
+	}
+	if contacts.Sponsor == "" && isEmailAddress(cd.Annotations[SponsorAnnotation]) {
+		contacts.Sponsor = cd.Annotations[SponsorAnnotation]
+	}
+
+	if contacts.Primary != "" || contacts.Secondary != "" {
+		return contacts, nil
+	}
+
+	labsecret, err := k8sclient.CoreV1().Secrets(cd.Namespace).Get(context.Background(), cd.Name, metav1.GetOptions{})
+	if err != nil {
+		return contacts, fmt.Errorf("no contacts recorded on cluster %v and unable to get its lab secret: %w", cd.Name, err)
+	}
+
+	contacts.Primary = string(labsecret.Data["primaryContactEmail"])
+	contacts.Secondary = string(labsecret.Data["secondaryContactEmail"])
+	if sponsor := string(labsecret.Data["redHatSponsor"]); contacts.Sponsor == "" && isEmailAddress(sponsor) {
+		contacts.Sponsor = sponsor
+	}
+
+	return contacts, nil
+}
+
+// To returns the primary and secondary contact, the people the lab is for
+func (c Contacts) To() []string {
+	var to []string
+	for _, contact := range []string{c.Primary, c.Secondary} {
+		if contact != "" && !Contains(to, contact) {
+			to = append(to, contact)
+		}
+	}
+
+	return to
+}
+
+// Cc returns the sponsor unless the sponsor is also one of the contacts
+func (c Contacts) Cc() []string {
+	if c.Sponsor == "" || Contains(c.To(), c.Sponsor) {
+		return nil
+	}
+
+	return []string{c.Sponsor}
+}
+
+// isEmailAddress tells an email address apart from a name; the sponsor of a request may be either
+func isEmailAddress(value string) bool {
+	address, err := netmail.ParseAddress(value)
+	return err == nil && address.Address == strings.TrimSpace(value)
+}
+
 func GetClusterDeployments() map[string]interface{} {
 	cfg, err := DefaultClientK8sAuthenticate()
 	if err != nil {
@@ -101,8 +203,19 @@ func CreateClusterDeployment(labRequest *LabRequest) {
 	leasetime := []string{"one-day", "one-week", "two-weeks", "one-month"}
 
 	oplLabels := map[string]string{
-		"opl-region":     labRequest.Availability,
+		RegionLabel:      labRequest.Availability,
 		"opl-lease-time": leasetime[labRequest.LeaseTime],
+		OwnerLabel:       labRequest.ID.String(),
+	}
+
+	oplAnnotations := map[string]string{
+		CompanyAnnotation:          labRequest.CompanyName,
+		PrimaryContactAnnotation:   labRequest.PrimaryContactEmail,
+		SecondaryContactAnnotation: labRequest.SecondaryContactEmail,
+		SponsorAnnotation:          labRequest.RedHatSponsor,
+	}
+	if isEmailAddress(labRequest.RedHatSponsor) {
+		oplAnnotations[SponsorContactAnnotation] = labRequest.RedHatSponsor
 	}
 
 	charsFromID := strings.Split(labRequest.ID.String(), "-")[0]
@@ -120,9 +233,10 @@ func CreateClusterDeployment(labRequest *LabRequest) {
 
 	cd := hivev1.ClusterDeployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      labRequest.ID.String(),
-			Namespace: "hive",
-			Labels:    oplLabels,
+			Name:        labRequest.ID.String(),
+			Namespace:   "hive",
+			Labels:      oplLabels,
+			Annotations: oplAnnotations,
 		},
 		Spec: cds,
 	}
@@ -3,12 +3,21 @@ package internal
 import (
 	"bytes"
 	"embed"
-	"github.com/gobuffalo/envy"
-	mail "github.com/xhit/go-simple-mail/v2"
-	"time"
-
+	"errors"
+	"fmt"
 	"html/template"
+	"io/fs"
+	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	mail "github.com/xhit/go-simple-mail/v2"
 )
 
 var timezonetext = map[string]string{
@@ -20,6 +29,28 @@ var timezonetext = map[string]string{
 //go:embed assets/*
 var assetData embed.FS
 
+// partials are executed by every template; logo.html, extra.html and signature.html are empty so
+// companies and sponsors can be branded by overriding them
+var partials = []string{"links.html", "logo.html", "extra.html", "signature.html"}
+
+// templateFS looks templates up in each of its file systems in turn, so the first one holding a
+// file overrides the ones after it
+type templateFS []fs.FS
+
+func (t templateFS) Open(name string) (fs.File, error) {
+	for _, fsys := range t {
+		file, err := fsys.Open(name)
+		if err == nil {
+			return file, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
 func init() {
 	// Load environment variables
 	err := envy.Load(".env")
@@ -28,244 +59,477 @@ func init() {
 	}
 }
 
-func SendWelcomeEmail(to *[]string, cc *[]string, bcc *[]string, clusterinfo map[string]string) {
-	var b bytes.Buffer
-
-	server := mail.NewSMTPClient()
+// MessageKind is a kind of email the Mailer sends. Template is the name of the asset holding the html
+// body, Subject a text/template of the subject line; both are executed with MessageData. Required lists
+// the keys of the cluster info that must not be empty for the email to make sense.
+type MessageKind struct {
+	Name     string
+	Template string
+	Subject  string
+	Required []string
+}
 
-	server.Port = 587
-	server.Host = envy.Get("SMTP_HOST", "localhost")
-	server.Username = envy.Get("SMTP_USER", "")
-	server.Password = envy.Get("SMTP_PASSWORD", "")
-	server.Encryption = mail.EncryptionSTARTTLS
-	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
+// DefaultMessageKinds are the emails oplmgr knows how to send out of the box
+var DefaultMessageKinds = []MessageKind{
+	{
+		Name:     "welcome",
+		Template: "welcome.html",
+		Subject:  "OpenShift Partner Lab {{ .ClusterID }} - {{ .Company }}",
+		Required: []string{"clusterid", "company", "consoleurl", "kubeadmin", "kubeconfig"},
+	},
+	{
+		Name:     "credentials",
+		Template: "credentials.html",
+		Subject:  "OpenShift Partner Lab Credentials {{ .ClusterID }} - {{ .Company }}",
+		Required: []string{"clusterid", "company", "consoleurl", "kubeadmin", "kubeconfig"},
+	},
+	{
+		Name:     "kubeadmin",
+		Template: "kubeadmin.html",
+		Subject:  "OpenShift Partner Lab Credentials {{ .ClusterID }} - {{ .Company }}",
+		Required: []string{"clusterid", "company", "consoleurl", "kubeadmin"},
+	},
+	{
+		Name:     "kubeconfig",
+		Template: "kubeconfig.html",
+		Subject:  "OpenShift Partner Lab Credentials {{ .ClusterID }} - {{ .Company }}",
+		Required: []string{"clusterid", "company", "kubeconfig"},
+	},
+	{
+		Name:     "hibernation-warning",
+		Template: "hibernation-warning.html",
+		Subject:  "OpenShift Partner Lab {{ .ClusterID }} - {{ .Company }} will hibernate in {{ .Remaining }}",
+		Required: []string{"clusterid", "when", "remaining"},
+	},
+	{
+		Name:     "deletion-warning",
+		Template: "deletion-warning.html",
+		Subject:  "OpenShift Partner Lab {{ .ClusterID }} - {{ .Company }} will be deleted in {{ .Remaining }}",
+		Required: []string{"clusterid", "when", "remaining"},
+	},
+	{
+		Name:     "deletion-notice",
+		Template: "deletion-notice.html",
+		Subject:  "OpenShift Partner Lab {{ .ClusterID }} - {{ .Company }} has been deleted",
+		Required: []string{"clusterid", "when"},
+	},
+}
 
-	smtpClient, err := server.Connect()
-	if err != nil {
-		log.Fatalf("Unable to create client so failing: %v\n", err)
+// Needs reports whether the kind requires the given key of the cluster info
+func (k MessageKind) Needs(key string) bool {
+	for _, required := range k.Required {
+		if required == key {
+			return true
+		}
 	}
 
-	t, err := template.ParseFS(assetData, "assets/welcome.html")
-	if err != nil {
-		log.Printf("Unable to parse welcome email html template: %v\n", err)
-	}
+	return false
+}
 
-	welcome := struct {
-		ConsoleURL     string
-		KubeAdminLink  string
-		KubeConfigLink string
-		Timezone       string
-	}{
+// MessageData is what the body and subject of every kind are executed with. Info holds the whole
+// cluster info so kinds added later can use keys that have no field of their own, e.g. {{ .Info.region }}.
+type MessageData struct {
+	ClusterID      string
+	Company        string
+	Sponsor        string
+	ConsoleURL     string
+	KubeAdminLink  string
+	KubeConfigLink string
+	Timezone       string
+	When           string
+	Remaining      string
+	RequestURL     string
+	SupportURL     string
+	SupportEmail   string
+	Info           map[string]string
+}
+
+// NewMessageData maps the cluster info the commands collect onto the fields the templates use
+func NewMessageData(clusterinfo map[string]string) MessageData {
+	return MessageData{
+		ClusterID:      clusterinfo["clusterid"],
+		Company:        clusterinfo["company"],
+		Sponsor:        clusterinfo["sponsor"],
 		ConsoleURL:     clusterinfo["consoleurl"],
 		KubeAdminLink:  clusterinfo["kubeadmin"],
 		KubeConfigLink: clusterinfo["kubeconfig"],
 		Timezone:       timezonetext[clusterinfo["timezone"]],
+		When:           clusterinfo["when"],
+		Remaining:      clusterinfo["remaining"],
+		RequestURL:     clusterinfo["requesturl"],
+		SupportURL:     clusterinfo["supporturl"],
+		SupportEmail:   clusterinfo["supportemail"],
+		Info:           clusterinfo,
 	}
+}
 
-	err = t.Execute(&b, &welcome)
-	if err != nil {
-		log.Printf("Unable to execute template: %v\n", err)
-	}
+// Message is a rendered email ready to be sent
+type Message struct {
+	Kind    string
+	To      []string
+	Cc      []string
+	Bcc     []string
+	Subject string
+	HTML    string
+	Text    string
+}
 
-	email := mail.NewMSG()
-	email.SetFrom("OpenShift Partner Labs <opl-no-reply@redhat.com>").
-		AddTo(*to...).
-		AddCc(*cc...).
-		AddBcc(*bcc...).
-		SetSubject("OpenShift Partner Lab " + clusterinfo["clusterid"] + " - " + clusterinfo["company"])
+// messageTemplates are the parsed templates of a registered kind; text is nil when the text/plain
+// alternative is generated from the html body
+type messageTemplates struct {
+	kind    MessageKind
+	body    *template.Template
+	text    *texttemplate.Template
+	subject *texttemplate.Template
+}
 
-	email.SetBody(mail.TextHTML, b.String())
+// Mailer renders the registered kinds of email and sends them over SMTP. Templates are taken from
+// TemplatesDir when it holds a file of the same name and from the embedded assets otherwise. Emails
+// of a company or sponsor with a directory of their own under companies/ or sponsors/ of
+// TemplatesDir use the files found there first, e.g. companies/acme-corp/logo.html. Emails sent with
+// SendOrQueue that fail are kept in the Outbox directory, when set, to be retried.
+type Mailer struct {
+	Host           string
+	Port           int
+	Encryption     string
+	Auth           string
+	Username       string
+	Password       string
+	CAFile         string
+	ConnectTimeout time.Duration
+	SendTimeout    time.Duration
+	From           string
+	ReplyTo        string
+	TemplatesDir   string
+	Outbox         string
+
+	kinds map[string]messageTemplates
+}
 
-	if email.Error != nil {
-		log.Fatalf("An error occurred prior to sending: %v\n", email.Error)
+// NewMailer returns a Mailer configured from the SMTP_* environment variables of SMTPSettings with the
+// default kinds registered. Without them it sends over STARTTLS to port 587 of localhost.
+func NewMailer() (*Mailer, error) {
+	m := &Mailer{
+		Host:           "localhost",
+		Encryption:     EncryptionSTARTTLS,
+		Auth:           AuthPlain,
+		ConnectTimeout: 10 * time.Second,
+		SendTimeout:    10 * time.Second,
+		From:           "OpenShift Partner Labs <opl-no-reply@redhat.com>",
+		kinds:          make(map[string]messageTemplates),
 	}
 
-	err = email.Send(smtpClient)
-	if err != nil {
-		log.Printf("An error occurred sending email: %v\n", err)
-	} else {
-		log.Println("welcome email sent successfully.")
+	if err := m.Configure(smtpEnvironment()); err != nil {
+		return nil, err
 	}
-}
 
-func SendCredsEmail(to *[]string, cc *[]string, bcc *[]string, clusterinfo map[string]string) {
-	var b bytes.Buffer
+	for _, kind := range DefaultMessageKinds {
+		if err := m.Register(kind); err != nil {
+			return nil, err
+		}
+	}
 
-	server := mail.NewSMTPClient()
+	return m, nil
+}
 
-	server.Port = 587
-	server.Host = envy.Get("SMTP_HOST", "localhost")
-	server.Username = envy.Get("SMTP_USER", "")
-	server.Password = envy.Get("SMTP_PASSWORD", "")
-	server.Encryption = mail.EncryptionSTARTTLS
-	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
+// Register adds a kind of email, replacing a registered kind of the same name. The templates are
+// parsed and executed with empty data straight away so a broken kind, or a field MessageData does
+// not have, is reported before anything is sent.
+func (m *Mailer) Register(kind MessageKind) error {
+	if kind.Name == "" {
+		return fmt.Errorf("message kind has no name")
+	}
 
-	smtpClient, err := server.Connect()
+	body, text, err := m.parse(kind, m.templateFS(nil))
 	if err != nil {
-		log.Fatalf("Unable to create client so failing: %v\n", err)
+		return err
 	}
 
-	t, err := template.ParseFS(assetData, "assets/credentials.html")
+	subject, err := texttemplate.New(kind.Name).Parse(kind.Subject)
 	if err != nil {
-		log.Printf("Unable to parse credentials email html template: %v\n", err)
+		return fmt.Errorf("unable to parse %v email subject: %w", kind.Name, err)
+	}
+	if err = subject.Execute(ioutil.Discard, &MessageData{}); err != nil {
+		return fmt.Errorf("invalid %v email subject: %w", kind.Name, err)
 	}
 
-	credentials := struct {
-		ConsoleURL     string
-		KubeAdminLink  string
-		KubeConfigLink string
-	}{
-		ConsoleURL:     clusterinfo["consoleurl"],
-		KubeAdminLink:  clusterinfo["kubeadmin"],
-		KubeConfigLink: clusterinfo["kubeconfig"],
+	m.kinds[kind.Name] = messageTemplates{kind: kind, body: body, text: text, subject: subject}
+
+	return nil
+}
+
+// LoadTemplates makes the Mailer use the templates in dir and checks every registered kind against
+// them, including the overlays of every company and sponsor
+func (m *Mailer) LoadTemplates(dir string) error {
+	if info, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("unable to use templates directory %v: %w", dir, err)
+	} else if !info.IsDir() {
+		return fmt.Errorf("templates directory %v is not a directory", dir)
 	}
 
-	err = t.Execute(&b, &credentials)
-	if err != nil {
-		log.Printf("Unable to execute template: %v\n", err)
+	m.TemplatesDir = dir
+
+	for _, templates := range m.kinds {
+		if err := m.Register(templates.kind); err != nil {
+			return err
+		}
 	}
 
-	email := mail.NewMSG()
-	email.SetFrom("OpenShift Partner Labs <opl-no-reply@redhat.com>").
-		AddTo(*to...).
-		AddCc(*cc...).
-		AddBcc(*bcc...).
-		SetSubject("OpenShift Partner Lab Credentials " + clusterinfo["clusterid"] + " - " + clusterinfo["company"])
+	for _, group := range []string{"companies", "sponsors"} {
+		entries, err := ioutil.ReadDir(filepath.Join(dir, group))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read %v templates: %w", group, err)
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			overlay := os.DirFS(filepath.Join(dir, group, entry.Name()))
+			for _, templates := range m.kinds {
+				if _, _, err = m.parse(templates.kind, m.templateFS([]fs.FS{overlay})); err != nil {
+					return fmt.Errorf("%v/%v: %w", group, entry.Name(), err)
+				}
+			}
+		}
+	}
 
-	email.SetBody(mail.TextHTML, b.String())
+	return nil
+}
 
-	if email.Error != nil {
-		log.Fatalf("An error occurred prior to sending: %v\n", email.Error)
+// templateFS returns the file systems templates are looked up in; the overlays, the templates
+// directory and the embedded assets
+func (m *Mailer) templateFS(overlays []fs.FS) templateFS {
+	fsys := append(templateFS{}, overlays...)
+	if m.TemplatesDir != "" {
+		fsys = append(fsys, os.DirFS(m.TemplatesDir))
 	}
 
-	err = email.Send(smtpClient)
+	assets, err := fs.Sub(assetData, "assets")
 	if err != nil {
-		log.Printf("An error occurred sending email: %v\n", err)
-	} else {
-		log.Println("credentials email sent successfully.")
+		log.Printf("Unable to read embedded email templates: %v\n", err)
 	}
+
+	return append(fsys, assets)
 }
 
-func SendAdminEmail(to *[]string, cc *[]string, bcc *[]string, clusterinfo map[string]string) {
-	var b bytes.Buffer
+// overlays returns the company and sponsor directories that apply to an email, most specific first
+func (m *Mailer) overlays(data MessageData) []fs.FS {
+	if m.TemplatesDir == "" {
+		return nil
+	}
 
-	server := mail.NewSMTPClient()
+	var overlays []fs.FS
+	for _, overlay := range [][2]string{{"companies", data.Company}, {"sponsors", data.Sponsor}} {
+		if Slug(overlay[1]) == "" {
+			continue
+		}
 
-	server.Port = 587
-	server.Host = envy.Get("SMTP_HOST", "localhost")
-	server.Username = envy.Get("SMTP_USER", "")
-	server.Password = envy.Get("SMTP_PASSWORD", "")
-	server.Encryption = mail.EncryptionSTARTTLS
-	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
+		dir := filepath.Join(m.TemplatesDir, overlay[0], Slug(overlay[1]))
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			overlays = append(overlays, os.DirFS(dir))
+		}
+	}
 
-	smtpClient, err := server.Connect()
+	return overlays
+}
+
+// parse reads the html body of the kind and the partials from fsys, and the text body when there is
+// a .txt file next to the html one, e.g. welcome.txt. Both are executed with empty data.
+func (m *Mailer) parse(kind MessageKind, fsys fs.FS) (*template.Template, *texttemplate.Template, error) {
+	body, err := template.ParseFS(fsys, append([]string{kind.Template}, partials...)...)
 	if err != nil {
-		log.Fatalf("Unable to create client so failing: %v\n", err)
+		return nil, nil, fmt.Errorf("unable to parse %v email html template: %w", kind.Name, err)
 	}
 
-	t, err := template.ParseFS(assetData, "assets/kubeadmin.html")
-	if err != nil {
-		log.Printf("Unable to parse kubeadmin email html template: %v\n", err)
+	if err = body.Execute(ioutil.Discard, &MessageData{}); err != nil {
+		return nil, nil, fmt.Errorf("invalid %v email html template: %w", kind.Name, err)
 	}
 
-	kubeadmin := struct {
-		ConsoleURL     string
-		KubeAdminLink  string
-		KubeConfigLink string
-	}{
-		ConsoleURL:     clusterinfo["consoleurl"],
-		KubeAdminLink:  clusterinfo["kubeadmin"],
-		KubeConfigLink: clusterinfo["kubeconfig"],
+	textname := textTemplateName(kind.Template)
+	if _, err = fs.Stat(fsys, textname); err != nil {
+		return body, nil, nil
+	}
+
+	// text partials are optional; a text body can only include the ones that exist
+	names := []string{textname}
+	for _, partial := range partials {
+		if _, err = fs.Stat(fsys, textTemplateName(partial)); err == nil {
+			names = append(names, textTemplateName(partial))
+		}
 	}
 
-	err = t.Execute(&b, &kubeadmin)
+	text, err := texttemplate.ParseFS(fsys, names...)
 	if err != nil {
-		log.Printf("Unable to execute template: %v\n", err)
+		return nil, nil, fmt.Errorf("unable to parse %v email text template: %w", kind.Name, err)
 	}
 
-	email := mail.NewMSG()
-	email.SetFrom("OpenShift Partner Labs <opl-no-reply@redhat.com>").
-		AddTo(*to...).
-		AddCc(*cc...).
-		AddBcc(*bcc...).
-		SetSubject("OpenShift Partner Lab Credentials " + clusterinfo["clusterid"] + " - " + clusterinfo["company"])
+	if err = text.Execute(ioutil.Discard, &MessageData{}); err != nil {
+		return nil, nil, fmt.Errorf("invalid %v email text template: %w", kind.Name, err)
+	}
+
+	return body, text, nil
+}
 
-	email.SetBody(mail.TextHTML, b.String())
+// textTemplateName returns the name of the text template of an html template, e.g. welcome.txt
+func textTemplateName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".txt"
+}
 
-	if email.Error != nil {
-		log.Fatalf("An error occurred prior to sending: %v\n", email.Error)
+// Kinds returns the names of the registered kinds in alphabetical order
+func (m *Mailer) Kinds() []string {
+	names := make([]string, 0, len(m.kinds))
+	for name := range m.kinds {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	err = email.Send(smtpClient)
-	if err != nil {
-		log.Printf("An error occurred sending email: %v\n", err)
-	} else {
-		log.Println("kubeadmin email sent successfully.")
+	return names
+}
+
+// Kind returns a registered kind
+func (m *Mailer) Kind(name string) (MessageKind, bool) {
+	templates, ok := m.kinds[name]
+	return templates.kind, ok
+}
+
+// Validate checks an email of the given kind has recipients and that the cluster info holds every
+// required key, so callers can find out before creating anything the email links to
+func (m *Mailer) Validate(kind string, to []string, cc []string, bcc []string, clusterinfo map[string]string) error {
+	templates, ok := m.kinds[kind]
+	if !ok {
+		return fmt.Errorf("unknown email type %v; use one of %v", kind, strings.Join(m.Kinds(), ", "))
+	}
+
+	var missing []string
+	for _, key := range templates.kind.Required {
+		if clusterinfo[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%v email is missing %v", kind, strings.Join(missing, ", "))
+	}
+
+	if len(to)+len(cc)+len(bcc) == 0 {
+		return fmt.Errorf("%v email has no recipients", kind)
 	}
+
+	return nil
 }
 
-func SendConfigEmail(to *[]string, cc *[]string, bcc *[]string, clusterinfo map[string]string) {
-	var b bytes.Buffer
+// Render builds the email of the given kind after checking the cluster info holds every required key
+func (m *Mailer) Render(kind string, to []string, cc []string, bcc []string, clusterinfo map[string]string) (*Message, error) {
+	templates, ok := m.kinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown email type %v; use one of %v", kind, strings.Join(m.Kinds(), ", "))
+	}
+
+	if err := m.Validate(kind, to, cc, bcc, clusterinfo); err != nil {
+		return nil, err
+	}
 
-	server := mail.NewSMTPClient()
+	data := NewMessageData(clusterinfo)
 
-	server.Port = 587
-	server.Host = envy.Get("SMTP_HOST", "localhost")
-	server.Username = envy.Get("SMTP_USER", "")
-	server.Password = envy.Get("SMTP_PASSWORD", "")
-	server.Encryption = mail.EncryptionSTARTTLS
-	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
+	bodytemplate, textbody := templates.body, templates.text
+	if overlays := m.overlays(data); len(overlays) > 0 {
+		var err error
+		if bodytemplate, textbody, err = m.parse(templates.kind, m.templateFS(overlays)); err != nil {
+			return nil, err
+		}
+	}
 
-	smtpClient, err := server.Connect()
+	var subject, body bytes.Buffer
+	if err := templates.subject.Execute(&subject, &data); err != nil {
+		return nil, fmt.Errorf("unable to execute %v email subject: %w", kind, err)
+	}
+	if err := bodytemplate.Execute(&body, &data); err != nil {
+		return nil, fmt.Errorf("unable to execute %v email template: %w", kind, err)
+	}
+
+	text := HTMLToText(body.String())
+	if textbody != nil {
+		var b bytes.Buffer
+		if err := textbody.Execute(&b, &data); err != nil {
+			return nil, fmt.Errorf("unable to execute %v email text template: %w", kind, err)
+		}
+		text = b.String()
+	}
+
+	return &Message{
+		Kind:    kind,
+		To:      to,
+		Cc:      cc,
+		Bcc:     bcc,
+		Subject: strings.TrimSpace(subject.String()),
+		HTML:    body.String(),
+		Text:    text,
+	}, nil
+}
+
+// Send renders the email of the given kind and sends it
+func (m *Mailer) Send(kind string, to []string, cc []string, bcc []string, clusterinfo map[string]string) error {
+	message, err := m.Render(kind, to, cc, bcc, clusterinfo)
 	if err != nil {
-		log.Fatalf("Unable to create client so failing: %v\n", err)
+		return err
 	}
 
-	t, err := template.ParseFS(assetData, "assets/kubeconfig.html")
+	return m.SendMessage(message)
+}
+
+// SendMessage sends an email rendered before
+func (m *Mailer) SendMessage(message *Message) error {
+	email, err := m.compose(message)
 	if err != nil {
-		log.Printf("Unable to parse kubeconfig email html template: %v\n", err)
+		return err
 	}
 
-	kubeconfig := struct {
-		ConsoleURL     string
-		KubeAdminLink  string
-		KubeConfigLink string
-	}{
-		ConsoleURL:     clusterinfo["consoleurl"],
-		KubeAdminLink:  clusterinfo["kubeadmin"],
-		KubeConfigLink: clusterinfo["kubeconfig"],
+	smtpClient, err := m.Connect()
+	if err != nil {
+		return err
 	}
 
-	err = t.Execute(&b, &kubeconfig)
+	if err = email.Send(smtpClient); err != nil {
+		return fmt.Errorf("unable to send %v email: %w", message.Kind, err)
+	}
+
+	return nil
+}
+
+// MIME returns the message the way it is handed to the SMTP server, e.g. to be saved as a .eml file.
+// Bcc addresses are not part of it, like in the email the recipients get.
+func (m *Mailer) MIME(message *Message) (string, error) {
+	email, err := m.compose(message)
 	if err != nil {
-		log.Printf("Unable to execute template: %v\n", err)
+		return "", err
 	}
 
+	return email.GetMessage(), nil
+}
+
+// compose builds the multipart/alternative email of a message
+func (m *Mailer) compose(message *Message) (*mail.Email, error) {
 	email := mail.NewMSG()
-	email.SetFrom("OpenShift Partner Labs <opl-no-reply@redhat.com>").
-		AddTo(*to...).
-		AddCc(*cc...).
-		AddBcc(*bcc...).
-		SetSubject("OpenShift Partner Lab Credentials " + clusterinfo["clusterid"] + " - " + clusterinfo["company"])
+	email.SetFrom(m.From).
+		AddTo(message.To...).
+		AddCc(message.Cc...).
+		AddBcc(message.Bcc...).
+		SetSubject(message.Subject)
+	if m.ReplyTo != "" {
+		email.SetReplyTo(m.ReplyTo)
+	}
 
-	email.SetBody(mail.TextHTML, b.String())
+	// the plain text part goes first; clients show the last alternative they understand
+	email.SetBody(mail.TextPlain, message.Text)
+	email.AddAlternative(mail.TextHTML, message.HTML)
 
 	if email.Error != nil {
-		log.Fatalf("An error occurred prior to sending: %v\n", email.Error)
+		return nil, fmt.Errorf("an error occurred prior to sending: %w", email.Error)
 	}
 
-	err = email.Send(smtpClient)
-	if err != nil {
-		log.Printf("An error occurred sending email: %v\n", err)
-	} else {
-		log.Println("kubeconfig email sent successfully.")
-	}
+	return email, nil
 }
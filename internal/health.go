@@ -0,0 +1,341 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	configv1 "github.com/openshift/api/config/v1"
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	runtimec "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// HealthHealthy is the verdict for a cluster without problems
+	HealthHealthy = "Healthy"
+
+	// HealthProgressing is the verdict while the cluster is still rolling out a version
+	HealthProgressing = "Progressing"
+
+	// HealthDegraded is the verdict for a cluster that works but needs attention
+	HealthDegraded = "Degraded"
+
+	// HealthUnhealthy is the verdict for a cluster partners cannot rely on
+	HealthUnhealthy = "Unhealthy"
+
+	// HealthUnreachable is the verdict when the API of the cluster could not be reached
+	HealthUnreachable = "Unreachable"
+
+	// HealthSkipped is the verdict for clusters that are hibernating or not installed
+	HealthSkipped = "Skipped"
+
+	// adminKubeconfigKey is the key of the admin kubeconfig secret holding the kubeconfig
+	adminKubeconfigKey = "raw-kubeconfig"
+
+	// spokeTimeout bounds every request sent to a partner cluster
+	spokeTimeout = 15 * time.Second
+
+	controlPlaneRoleLabel = "node-role.kubernetes.io/master"
+
+	// versionFailing is the condition the cluster version operator reports instead of Degraded
+	versionFailing configv1.ClusterStatusConditionType = "Failing"
+)
+
+// HealthReport is what the health probe found inside a partner cluster
+type HealthReport struct {
+	ClusterID            string    `json:"clusterID"`
+	CheckedAt            time.Time `json:"checkedAt"`
+	Version              string    `json:"version,omitempty"`
+	VersionProgressing   bool      `json:"versionProgressing"`
+	VersionMessage       string    `json:"versionMessage,omitempty"`
+	VersionFailing       string    `json:"versionFailing,omitempty"`
+	Nodes                int       `json:"nodes"`
+	ReadyNodes           int       `json:"readyNodes"`
+	NotReadyNodes        []string  `json:"notReadyNodes,omitempty"`
+	DegradedOperators    []string  `json:"degradedOperators,omitempty"`
+	UnavailableOperators []string  `json:"unavailableOperators,omitempty"`
+	PendingCSRs          []string  `json:"pendingCSRs,omitempty"`
+	Verdict              string    `json:"verdict"`
+	Reasons              []string  `json:"reasons,omitempty"`
+	Error                string    `json:"error,omitempty"`
+}
+
+// AdminKubeconfig returns the admin kubeconfig of the partner cluster from the secret Hive stored on the hub
+func AdminKubeconfig(k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment) ([]byte, error) {
+	if cd.Spec.ClusterMetadata == nil || cd.Spec.ClusterMetadata.AdminKubeconfigSecretRef.Name == "" {
+		return nil, fmt.Errorf("cluster %v has no admin kubeconfig yet", cd.Name)
+	}
+
+	secretname := cd.Spec.ClusterMetadata.AdminKubeconfigSecretRef.Name
+	secret, err := k8sclient.CoreV1().Secrets(cd.Namespace).Get(context.Background(), secretname, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get admin kubeconfig secret %v: %w", secretname, err)
+	}
+
+	kubeconfig, ok := secret.Data[adminKubeconfigKey]
+	if !ok {
+		kubeconfig, ok = secret.Data["kubeconfig"]
+	}
+	if !ok {
+		return nil, fmt.Errorf("admin kubeconfig secret %v has no kubeconfig", secretname)
+	}
+
+	return kubeconfig, nil
+}
+
+// spokeConfig builds the rest config of the partner cluster from its admin kubeconfig secret on the hub
+func spokeConfig(k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment) (*rest.Config, error) {
+	kubeconfig, err := AdminKubeconfig(k8sclient, cd)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the admin kubeconfig of %v: %w", cd.Name, err)
+	}
+	cfg.Timeout = spokeTimeout
+
+	return cfg, nil
+}
+
+// SpokeClient builds a client for the partner cluster from its admin kubeconfig secret on the hub
+func SpokeClient(k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment) (runtimec.Client, error) {
+	cfg, err := spokeConfig(k8sclient, cd)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := runtime.NewScheme()
+	if err = clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("unable to add Kubernetes scheme to client: %w", err)
+	}
+	if err = configv1.Install(scheme); err != nil {
+		return nil, fmt.Errorf("unable to add OpenShift config scheme to client: %w", err)
+	}
+
+	spoke, err := runtimec.New(cfg, runtimec.Options{Scheme: scheme})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create client for %v: %w", cd.Name, err)
+	}
+
+	return spoke, nil
+}
+
+// SpokeClientset builds a Kubernetes clientset for the partner cluster, needed for subresources
+// such as the approval of certificate signing requests
+func SpokeClientset(k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment) (*kubernetes.Clientset, error) {
+	cfg, err := spokeConfig(k8sclient, cd)
+	if err != nil {
+		return nil, err
+	}
+
+	spoke, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create clientset for %v: %w", cd.Name, err)
+	}
+
+	return spoke, nil
+}
+
+// CheckHealth looks at the cluster version, nodes, cluster operators and certificate signing requests
+// of the partner cluster and gives a verdict. Clusters that are hibernating or not installed are skipped.
+func CheckHealth(ctx context.Context, k8sclient *kubernetes.Clientset, cd *hivev1.ClusterDeployment) HealthReport {
+	report := HealthReport{ClusterID: cd.Name, CheckedAt: time.Now().UTC().Truncate(time.Second)}
+
+	switch {
+	case !cd.Spec.Installed:
+		report.Verdict = HealthSkipped
+		report.Reasons = []string{"cluster is not installed"}
+		return report
+	case cd.Spec.PowerState == hivev1.HibernatingClusterPowerState:
+		report.Verdict = HealthSkipped
+		report.Reasons = []string{"cluster is hibernating"}
+		return report
+	}
+
+	spoke, err := SpokeClient(k8sclient, cd)
+	if err != nil {
+		report.Verdict = HealthUnreachable
+		report.Error = err.Error()
+		return report
+	}
+
+	// the cluster version is read first; when it fails the API is not answering and there is no point going on
+	if err = report.checkVersion(ctx, spoke); err != nil {
+		report.Verdict = HealthUnreachable
+		report.Error = err.Error()
+		return report
+	}
+
+	for _, check := range []func(context.Context, runtimec.Client) error{report.checkNodes, report.checkOperators, report.checkCSRs} {
+		if err = check(ctx, spoke); err != nil {
+			report.Reasons = append(report.Reasons, err.Error())
+		}
+	}
+
+	report.Verdict = report.verdict()
+
+	return report
+}
+
+func (r *HealthReport) checkVersion(ctx context.Context, spoke runtimec.Client) error {
+	version := &configv1.ClusterVersion{}
+	if err := spoke.Get(ctx, runtimec.ObjectKey{Name: "version"}, version); err != nil {
+		return fmt.Errorf("unable to get the cluster version: %w", err)
+	}
+
+	r.Version = version.Status.Desired.Version
+
+	for _, condition := range version.Status.Conditions {
+		switch condition.Type {
+		case configv1.OperatorProgressing:
+			r.VersionProgressing = condition.Status == configv1.ConditionTrue
+			r.VersionMessage = condition.Message
+		case versionFailing:
+			if condition.Status == configv1.ConditionTrue {
+				r.VersionFailing = condition.Message
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *HealthReport) checkNodes(ctx context.Context, spoke runtimec.Client) error {
+	nodes := &corev1.NodeList{}
+	if err := spoke.List(ctx, nodes); err != nil {
+		return fmt.Errorf("unable to list nodes: %w", err)
+	}
+
+	r.Nodes = len(nodes.Items)
+	for _, node := range nodes.Items {
+		if NodeReady(&node) {
+			r.ReadyNodes++
+			continue
+		}
+
+		name := node.Name
+		if _, controlplane := node.Labels[controlPlaneRoleLabel]; controlplane {
+			name += " (control plane)"
+		}
+		r.NotReadyNodes = append(r.NotReadyNodes, name)
+	}
+	sort.Strings(r.NotReadyNodes)
+
+	return nil
+}
+
+func (r *HealthReport) checkOperators(ctx context.Context, spoke runtimec.Client) error {
+	operators := &configv1.ClusterOperatorList{}
+	if err := spoke.List(ctx, operators); err != nil {
+		return fmt.Errorf("unable to list cluster operators: %w", err)
+	}
+
+	for _, operator := range operators.Items {
+		available := false
+		for _, condition := range operator.Status.Conditions {
+			switch {
+			case condition.Type == configv1.OperatorAvailable:
+				available = condition.Status == configv1.ConditionTrue
+			case condition.Type == configv1.OperatorDegraded && condition.Status == configv1.ConditionTrue:
+				r.DegradedOperators = append(r.DegradedOperators, operator.Name)
+			}
+		}
+
+		if !available {
+			r.UnavailableOperators = append(r.UnavailableOperators, operator.Name)
+		}
+	}
+	sort.Strings(r.DegradedOperators)
+	sort.Strings(r.UnavailableOperators)
+
+	return nil
+}
+
+func (r *HealthReport) checkCSRs(ctx context.Context, spoke runtimec.Client) error {
+	csrs := &certificatesv1.CertificateSigningRequestList{}
+	if err := spoke.List(ctx, csrs); err != nil {
+		return fmt.Errorf("unable to list certificate signing requests: %w", err)
+	}
+
+	for _, csr := range csrs.Items {
+		if CSRPending(&csr) {
+			r.PendingCSRs = append(r.PendingCSRs, csr.Name)
+		}
+	}
+	sort.Strings(r.PendingCSRs)
+
+	return nil
+}
+
+// verdict weighs the findings; anything keeping partners from using the cluster makes it unhealthy
+func (r *HealthReport) verdict() string {
+	var unhealthy, degraded []string
+
+	if r.Nodes > 0 && r.ReadyNodes == 0 {
+		unhealthy = append(unhealthy, "no node is ready")
+	}
+	for _, node := range r.NotReadyNodes {
+		degraded = append(degraded, "node "+node+" is not ready")
+	}
+	for _, operator := range r.UnavailableOperators {
+		unhealthy = append(unhealthy, "cluster operator "+operator+" is unavailable")
+	}
+	for _, operator := range r.DegradedOperators {
+		degraded = append(degraded, "cluster operator "+operator+" is degraded")
+	}
+	if len(r.PendingCSRs) > 0 {
+		degraded = append(degraded, fmt.Sprintf("%d certificate signing requests are pending", len(r.PendingCSRs)))
+	}
+	if r.VersionFailing != "" {
+		degraded = append(degraded, "cluster version is failing: "+r.VersionFailing)
+	}
+
+	// checks that could not run leave the verdict at degraded at best
+	degraded = append(degraded, r.Reasons...)
+	r.Reasons = append(unhealthy, degraded...)
+
+	switch {
+	case len(unhealthy) > 0:
+		return HealthUnhealthy
+	case len(degraded) > 0:
+		return HealthDegraded
+	case r.VersionProgressing:
+		r.Reasons = []string{r.VersionMessage}
+		return HealthProgressing
+	}
+
+	return HealthHealthy
+}
+
+// NodeReady reports whether the Ready condition of the node is True
+func NodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// CSRPending reports whether the certificate signing request was neither approved nor denied
+func CSRPending(csr *certificatesv1.CertificateSigningRequest) bool {
+	for _, condition := range csr.Status.Conditions {
+		if condition.Type == certificatesv1.CertificateApproved || condition.Type == certificatesv1.CertificateDenied || condition.Type == certificatesv1.CertificateFailed {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"encoding/json"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+)
+
+const (
+	// HistoryAnnotation keeps the recent power changes, emails and admin access of a lab so they can be archived
+	HistoryAnnotation = "opl-history"
+
+	// PowerEvent records a change of the cluster's powerState
+	PowerEvent = "power"
+
+	// EmailEvent records an email sent to the contacts of the cluster
+	EmailEvent = "email"
+
+	// DeleteEvent records a soft delete or restore of the cluster
+	DeleteEvent = "delete"
+
+	// AccessEvent records admin credentials of the cluster being handed out
+	AccessEvent = "access"
+
+	// maxHistory keeps the annotation well below the size limit of the object's metadata
+	maxHistory = 100
+)
+
+// HistoryEvent is a single entry of the history of a lab
+type HistoryEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Detail string    `json:"detail"`
+}
+
+// RecordHistory appends an event to the history of the cluster, dropping the oldest events once
+// there are more than maxHistory
+func RecordHistory(cd *hivev1.ClusterDeployment, kind string, detail string) {
+	if cd.Annotations == nil {
+		cd.Annotations = map[string]string{}
+	}
+
+	events := append(History(cd), HistoryEvent{Time: time.Now().UTC().Truncate(time.Second), Kind: kind, Detail: detail})
+	if len(events) > maxHistory {
+		events = events[len(events)-maxHistory:]
+	}
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		return
+	}
+
+	cd.Annotations[HistoryAnnotation] = string(data)
+}
+
+// History returns the events recorded on the cluster, oldest first
+func History(cd *hivev1.ClusterDeployment) []HistoryEvent {
+	var events []HistoryEvent
+
+	if history, ok := cd.Annotations[HistoryAnnotation]; ok {
+		if err := json.Unmarshal([]byte(history), &events); err != nil {
+			return nil
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// blockElements end a paragraph in the text version of an email
+var blockElements = map[string]bool{
+	"p": true, "div": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "table": true, "tr": true, "pre": true, "blockquote": true,
+}
+
+// hiddenElements hold text that is not shown, such as the stylesheets of custom templates
+var hiddenElements = map[string]bool{"style": true, "script": true, "title": true}
+
+var (
+	spaces     = regexp.MustCompile(`[ \t\r\n]+`)
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// preformatted marks the lines of <pre> elements so finishText keeps their whitespace
+const preformatted = "\x00"
+
+// HTMLToText turns the html body of an email into the text/plain alternative sent along with it.
+// Paragraphs and headings are separated by blank lines, line breaks are kept, list items get a dash,
+// images are replaced by their alt text and links are followed by their address when it differs from
+// their text. The whitespace of <pre> elements is kept and <style>, <script> and <title> are left out.
+func HTMLToText(body string) string {
+	var b strings.Builder
+	var href string
+	var linktext strings.Builder
+	inlink := false
+	hidden, pre := 0, 0
+	prestart := false
+
+	write := func(text string) {
+		if inlink {
+			linktext.WriteString(text)
+			return
+		}
+		b.WriteString(text)
+	}
+
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return finishText(b.String())
+		case html.TextToken:
+			text := html.UnescapeString(string(z.Text()))
+			switch {
+			case hidden > 0:
+			case pre > 0:
+				// a newline right after <pre> is not part of its content
+				if prestart {
+					text = strings.TrimPrefix(text, "\n")
+				}
+				write(strings.ReplaceAll(text, "\n", "\n"+preformatted))
+			default:
+				write(spaces.ReplaceAllString(text, " "))
+			}
+			prestart = false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if hidden > 0 {
+				continue
+			}
+			switch {
+			case hiddenElements[token.Data]:
+				if token.Type != html.SelfClosingTagToken {
+					hidden++
+				}
+			case token.Data == "pre":
+				pre++
+				prestart = true
+				write("\n\n" + preformatted)
+			case token.Data == "br" && pre > 0:
+				write("\n" + preformatted)
+			case token.Data == "br":
+				write("\n")
+			case token.Data == "li":
+				write("\n- ")
+			case token.Data == "img":
+				if alt := attribute(token, "alt"); alt != "" {
+					write("[" + alt + "]")
+				}
+			case token.Data == "a":
+				href, inlink = attribute(token, "href"), true
+				linktext.Reset()
+			case blockElements[token.Data]:
+				write("\n\n")
+			}
+		case html.EndTagToken:
+			token := z.Token()
+			switch {
+			case hiddenElements[token.Data]:
+				if hidden > 0 {
+					hidden--
+				}
+			case hidden > 0:
+			case token.Data == "pre":
+				if pre > 0 {
+					pre--
+				}
+				write("\n\n")
+			case token.Data == "a" && inlink:
+				inlink = false
+				text := strings.TrimSpace(linktext.String())
+				b.WriteString(text)
+				if href != "" && href != text && !strings.HasPrefix(href, "#") {
+					b.WriteString(" (" + href + ")")
+				}
+			case blockElements[token.Data]:
+				write("\n\n")
+			}
+		}
+	}
+}
+
+// finishText trims the spaces html indentation leaves around lines and collapses blank lines, except
+// in the lines of <pre> elements
+func finishText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, preformatted) {
+			lines[i] = strings.TrimSpace(line)
+		}
+	}
+
+	text = strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+
+	return strings.ReplaceAll(text, preformatted, "") + "\n"
+}
+
+func attribute(token html.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return attr.Val
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,70 @@
+package internal
+
+import "testing"
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "paragraphs",
+			html: "<p>Hello\n      there</p>\n<p>Second   paragraph</p>",
+			want: "Hello there\n\nSecond paragraph\n",
+		},
+		{
+			name: "line breaks and headings",
+			html: "<h1>Title</h1>line one<br>line two<br/>",
+			want: "Title\n\nline one\nline two\n",
+		},
+		{
+			name: "list",
+			html: "<ul><li>one</li><li>two</li></ul>",
+			want: "- one\n- two\n",
+		},
+		{
+			name: "links",
+			html: `<p><a href="https://console.example.com">console</a> <a href="https://a.example.com">https://a.example.com</a> <a href="#top">top</a></p>`,
+			want: "console (https://console.example.com) https://a.example.com top\n",
+		},
+		{
+			name: "image alt text",
+			html: `<img src="logo.png" alt="Red Hat"><img src="spacer.gif">`,
+			want: "[Red Hat]\n",
+		},
+		{
+			name: "entities",
+			html: "<p>Tom &amp; Jerry &lt;3</p>",
+			want: "Tom & Jerry <3\n",
+		},
+		{
+			name: "style, script and title",
+			html: "<html><head><title>Lab</title><style>p { color: red; }</style></head><body><script>alert(1)</script><p>Body</p></body></html>",
+			want: "Body\n",
+		},
+		{
+			name: "pre keeps whitespace",
+			html: "<p>Run:</p><pre>\noc get nodes \\\n    -o wide\n\n  done</pre><p>Then   log in</p>",
+			want: "Run:\n\noc get nodes \\\n    -o wide\n\n  done\n\nThen log in\n",
+		},
+		{
+			name: "pre with line break",
+			html: "<pre>  a<br>  b</pre>",
+			want: "  a\n  b\n",
+		},
+		{
+			name: "blank lines collapse",
+			html: "<div><div><p>a</p></div></div><p>b</p>",
+			want: "a\n\nb\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := HTMLToText(test.html); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
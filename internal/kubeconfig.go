@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// KubeconfigContextName names the context of a partner cluster after its company and id, e.g.
+// opl-acme-corp-b592ec70-487f-44fc-a389-80bbf111ec96
+func KubeconfigContextName(cd *hivev1.ClusterDeployment) string {
+	company := Slug(cd.Annotations[CompanyAnnotation])
+	if company == "" {
+		return "opl-" + cd.Name
+	}
+
+	return "opl-" + company + "-" + cd.Name
+}
+
+// MergeKubeconfig adds the current context of kubeconfig to the kubeconfig file at path, with its
+// context, cluster and user all named name. Entries of that name are replaced and the current context
+// of the file is left alone. The file is created when it does not exist.
+func MergeKubeconfig(path string, kubeconfig []byte, name string) error {
+	admin, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("unable to parse the admin kubeconfig: %w", err)
+	}
+
+	context, ok := admin.Contexts[admin.CurrentContext]
+	if !ok {
+		return fmt.Errorf("the admin kubeconfig has no current context")
+	}
+	cluster, ok := admin.Clusters[context.Cluster]
+	if !ok {
+		return fmt.Errorf("the admin kubeconfig has no cluster %v", context.Cluster)
+	}
+	authinfo, ok := admin.AuthInfos[context.AuthInfo]
+	if !ok {
+		return fmt.Errorf("the admin kubeconfig has no user %v", context.AuthInfo)
+	}
+
+	config, err := loadKubeconfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	merged := context.DeepCopy()
+	merged.Cluster = name
+	merged.AuthInfo = name
+
+	config.Clusters[name] = cluster
+	config.AuthInfos[name] = authinfo
+	config.Contexts[name] = merged
+
+	return writeKubeconfigFile(path, config)
+}
+
+// RemoveKubeconfig removes the contexts merged for the cluster from the kubeconfig file at path,
+// together with their cluster and user, and returns their names. Contexts are found by cluster id so
+// they are removed even when the company of the cluster changed or the cluster is gone.
+func RemoveKubeconfig(path string, clusterid string) ([]string, error) {
+	config, err := loadKubeconfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for name := range config.Contexts {
+		if name != "opl-"+clusterid && !(strings.HasPrefix(name, "opl-") && strings.HasSuffix(name, "-"+clusterid)) {
+			continue
+		}
+
+		delete(config.Contexts, name)
+		delete(config.Clusters, name)
+		delete(config.AuthInfos, name)
+		removed = append(removed, name)
+
+		if config.CurrentContext == name {
+			config.CurrentContext = ""
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	sort.Strings(removed)
+
+	return removed, writeKubeconfigFile(path, config)
+}
+
+// WriteKubeconfig writes the admin kubeconfig as is to path, readable by the owner only. An existing
+// file is never overwritten.
+func WriteKubeconfig(path string, kubeconfig []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create directory of %v: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to create %v: %w", path, err)
+	}
+
+	if _, err = file.Write(kubeconfig); err != nil {
+		file.Close()
+		return fmt.Errorf("unable to write %v: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+func loadKubeconfigFile(path string) (*clientcmdapi.Config, error) {
+	config, err := clientcmd.LoadFromFile(path)
+	if os.IsNotExist(err) {
+		return clientcmdapi.NewConfig(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load kubeconfig %v: %w", path, err)
+	}
+
+	return config, nil
+}
+
+func writeKubeconfigFile(path string, config *clientcmdapi.Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to create directory of %v: %w", path, err)
+	}
+
+	if err := clientcmd.WriteToFile(*config, path); err != nil {
+		return fmt.Errorf("unable to write kubeconfig %v: %w", path, err)
+	}
+
+	return nil
+}
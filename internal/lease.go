@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+)
+
+const (
+	// LeaseEndAnnotation overrides the lease end derived from the lease time label with an RFC3339 timestamp
+	LeaseEndAnnotation = "opl-lease-end"
+
+	// deleteAfterAnnotation is set by Hive's cluster builder from provision --delete-after
+	deleteAfterAnnotation = "hive.openshift.io/delete-after"
+)
+
+// leaseDurations maps the opl-lease-time label set by CreateClusterDeployment to the length of the lease
+var leaseDurations = map[string]time.Duration{
+	"one-day":   24 * time.Hour,
+	"one-week":  7 * 24 * time.Hour,
+	"two-weeks": 14 * 24 * time.Hour,
+	"one-month": 30 * 24 * time.Hour,
+}
+
+// LeaseEnd returns when the lab's lease is over. The opl-lease-end annotation wins over Hive's
+// delete-after annotation, which wins over the opl-lease-time label.
+func LeaseEnd(cd *hivev1.ClusterDeployment) (time.Time, bool) {
+	if end, ok := cd.Annotations[LeaseEndAnnotation]; ok {
+		if t, err := time.Parse(time.RFC3339, end); err == nil {
+			return t, true
+		}
+	}
+
+	if cd.CreationTimestamp.IsZero() {
+		return time.Time{}, false
+	}
+
+	if after, ok := cd.Annotations[deleteAfterAnnotation]; ok {
+		if dur, err := time.ParseDuration(after); err == nil {
+			return cd.CreationTimestamp.Add(dur), true
+		}
+	}
+
+	if dur, ok := leaseDurations[cd.Labels["opl-lease-time"]]; ok {
+		return cd.CreationTimestamp.Add(dur), true
+	}
+
+	return time.Time{}, false
+}
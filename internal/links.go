@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"os"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Links are the URLs put in info output, emails and reports. RequestURL turns a lab id into the URL
+// of its request; {id} is replaced with the lab id and {octet} with its first block.
+type Links struct {
+	RequestURL   string `mapstructure:"request-url" json:"requestURL,omitempty"`
+	SupportURL   string `mapstructure:"support-url" json:"supportURL,omitempty"`
+	SupportEmail string `mapstructure:"support-email" json:"supportEmail,omitempty"`
+}
+
+// HubLinks overrides the links for the hub behind a kube context
+type HubLinks struct {
+	Context string `mapstructure:"context"`
+	Links   Links  `mapstructure:"links"`
+}
+
+// DefaultLinks points at the production partner request UI
+func DefaultLinks() Links {
+	return Links{
+		RequestURL: "https://ui.apps.eng.partner-lab.rhecoeng.com/request/{id}",
+	}
+}
+
+// Merge returns the links with every field set in override replaced
+func (l Links) Merge(override Links) Links {
+	if override.RequestURL != "" {
+		l.RequestURL = override.RequestURL
+	}
+	if override.SupportURL != "" {
+		l.SupportURL = override.SupportURL
+	}
+	if override.SupportEmail != "" {
+		l.SupportEmail = override.SupportEmail
+	}
+
+	return l
+}
+
+// Request returns the URL of the request of the lab with the given id
+func (l Links) Request(id string) string {
+	if l.RequestURL == "" {
+		return ""
+	}
+
+	url := l.RequestURL
+	if !strings.Contains(url, "{id}") && !strings.Contains(url, "{octet}") {
+		url += "{id}"
+	}
+
+	return strings.NewReplacer("{id}", id, "{octet}", strings.Split(id, "-")[0]).Replace(url)
+}
+
+// CurrentHubContext returns the name of the kube context oplmgr talks to the hub through
+func CurrentHubContext() string {
+	cfg, err := clientcmd.LoadFromFile(os.Getenv("OPENSHIFT_KUBECONFIG"))
+	if err != nil {
+		return ""
+	}
+
+	return cfg.CurrentContext
+}
@@ -1,6 +1,10 @@
 package internal
 
-import "fmt"
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
 
 // vars and funcs for pastes
 var (
@@ -172,3 +176,12 @@ func Decode(src string) ([]byte, error) {
 }
 
 // funcs for emails that do not have a current place
+
+// nonSlugChars are replaced by a dash when a name is turned into a slug
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slug lowercases a name and replaces everything but letters and digits by dashes, e.g. Acme Corp.
+// becomes acme-corp
+func Slug(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
@@ -0,0 +1,273 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// OutboxExtension is the extension of the files of the outbox
+	OutboxExtension = ".json"
+
+	// outboxBackoff is how long the first retry of a queued email waits; it doubles with every attempt
+	outboxBackoff = time.Minute
+
+	// outboxMaxBackoff caps the wait between two attempts
+	outboxMaxBackoff = 6 * time.Hour
+
+	// OutboxMaxAge is how long an email is retried by default; the privatebin links in credential
+	// emails expire after a day, so sending them any later is no use
+	OutboxMaxAge = 24 * time.Hour
+
+	// outboxExpiredDir is the directory of the outbox expired entries are moved to
+	outboxExpiredDir = "expired"
+
+	// outboxLockFile is held by the flush working on the outbox
+	outboxLockFile = ".lock"
+
+	// outboxLockStale is how long a lock can go without being refreshed before it is taken over, so a
+	// flush that was killed does not block the outbox for good
+	outboxLockStale = 15 * time.Minute
+)
+
+// OutboxEntry is an email that could not be sent, kept in the outbox until a retry succeeds. The
+// message is kept as rendered so credential links minted for it are not lost.
+type OutboxEntry struct {
+	ID          string    `json:"id"`
+	ClusterID   string    `json:"clusterId"`
+	Message     Message   `json:"message"`
+	History     bool      `json:"history"`
+	QueuedAt    time.Time `json:"queuedAt"`
+	Attempts    int       `json:"attempts"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	LastError   string    `json:"lastError"`
+}
+
+// Due tells whether the backoff of the entry is over
+func (e *OutboxEntry) Due(now time.Time) bool {
+	return !now.Before(e.NextAttempt)
+}
+
+// Expired tells whether the entry was queued more than maxage ago and should not be sent anymore
+func (e *OutboxEntry) Expired(now time.Time, maxage time.Duration) bool {
+	return maxage > 0 && now.Sub(e.QueuedAt) > maxage
+}
+
+// Failed records a failed attempt and schedules the next one
+func (e *OutboxEntry) Failed(err error, now time.Time) {
+	e.Attempts++
+	e.LastAttempt = now
+	e.NextAttempt = now.Add(OutboxBackoff(e.Attempts))
+	e.LastError = err.Error()
+}
+
+// OutboxBackoff returns how long to wait after the given number of failed attempts; a minute after the
+// first, doubling up to six hours
+func OutboxBackoff(attempts int) time.Duration {
+	backoff := outboxBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+
+	return backoff
+}
+
+// SendOrQueue sends a message and puts it in the outbox when sending fails. The entry is returned
+// along with the error of the send when the message was queued. History tells whether the email is
+// recorded in the history of the cluster once a retry succeeds.
+func (m *Mailer) SendOrQueue(message *Message, clusterid string, history bool) (*OutboxEntry, error) {
+	senderr := m.SendMessage(message)
+	if senderr == nil || m.Outbox == "" {
+		return nil, senderr
+	}
+
+	now := time.Now()
+	entry := &OutboxEntry{
+		ID:        fmt.Sprintf("%s-%s-%s", strings.Split(clusterid, "-")[0], message.Kind, now.UTC().Format("20060102T150405.000000")),
+		ClusterID: clusterid,
+		Message:   *message,
+		History:   history,
+		QueuedAt:  now,
+	}
+	entry.Failed(senderr, now)
+
+	if err := SaveOutboxEntry(m.Outbox, entry); err != nil {
+		return nil, fmt.Errorf("%v and unable to queue it: %w", senderr, err)
+	}
+
+	return entry, senderr
+}
+
+// SaveOutboxEntry writes an entry to the outbox directory, replacing an earlier version of it. Entries
+// hold credential links so only the owner can read them.
+func SaveOutboxEntry(dir string, entry *OutboxEntry) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("unable to create outbox directory %v: %w", dir, err)
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode outbox entry %v: %w", entry.ID, err)
+	}
+
+	// write next to the entry and rename so a flush never reads half an entry
+	path := filepath.Join(dir, entry.ID+OutboxExtension)
+	if err = ioutil.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("unable to write outbox entry %v: %w", entry.ID, err)
+	}
+
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("unable to write outbox entry %v: %w", entry.ID, err)
+	}
+
+	return nil
+}
+
+// RemoveOutboxEntry deletes an entry from the outbox directory once it is sent
+func RemoveOutboxEntry(dir string, entry *OutboxEntry) error {
+	if err := os.Remove(filepath.Join(dir, entry.ID+OutboxExtension)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove outbox entry %v: %w", entry.ID, err)
+	}
+
+	return nil
+}
+
+// ExpireOutboxEntry moves an entry that is too old to be sent to the expired directory of the outbox,
+// where it is kept for reference but never retried
+func ExpireOutboxEntry(dir string, entry *OutboxEntry) error {
+	expired := filepath.Join(dir, outboxExpiredDir)
+	if err := os.MkdirAll(expired, 0700); err != nil {
+		return fmt.Errorf("unable to create directory %v: %w", expired, err)
+	}
+
+	name := entry.ID + OutboxExtension
+	if err := os.Rename(filepath.Join(dir, name), filepath.Join(expired, name)); err != nil {
+		return fmt.Errorf("unable to expire outbox entry %v: %w", entry.ID, err)
+	}
+
+	return nil
+}
+
+// OutboxLock is held while the entries of an outbox are sent so two flushes running at the same time
+// never send an entry twice
+type OutboxLock struct {
+	path  string
+	owner string
+}
+
+// LockOutbox takes the lock of the outbox directory. It fails when another flush holds it, unless
+// that flush has not refreshed it for outboxLockStale.
+func LockOutbox(dir string) (*OutboxLock, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("unable to create outbox directory %v: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, outboxLockFile)
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			owner := fmt.Sprintf("%d %d\n", os.Getpid(), time.Now().UnixNano())
+			_, err = file.WriteString(owner)
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, fmt.Errorf("unable to write outbox lock %v: %w", path, err)
+			}
+			return &OutboxLock{path: path, owner: owner}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("unable to create outbox lock %v: %w", path, err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) < outboxLockStale {
+			return nil, fmt.Errorf("outbox %v is locked by another flush, last refreshed at %v", dir, info.ModTime().Format(time.RFC3339))
+		}
+
+		log.Printf("Taking over the outbox lock %v, it was last refreshed at %v\n", path, info.ModTime().Format(time.RFC3339))
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("unable to remove stale outbox lock %v: %w", path, err)
+		}
+	}
+
+	return nil, fmt.Errorf("unable to lock outbox %v", dir)
+}
+
+// Refresh tells other flushes the lock is still in use; call it between two sends
+func (l *OutboxLock) Refresh() error {
+	now := time.Now()
+	return os.Chtimes(l.path, now, now)
+}
+
+// Unlock releases the lock of the outbox, unless another flush took it over in the meantime
+func (l *OutboxLock) Unlock() error {
+	if owner, err := ioutil.ReadFile(l.path); err != nil || string(owner) != l.owner {
+		return nil
+	}
+
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("unable to remove outbox lock %v: %w", l.path, err)
+	}
+
+	return nil
+}
+
+// ListOutbox returns the entries of the outbox directory, oldest first. Entries that cannot be read
+// are logged and left out so they do not hold up the others.
+func ListOutbox(dir string) ([]*OutboxEntry, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to read outbox directory %v: %w", dir, err)
+	}
+
+	var entries []*OutboxEntry
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), OutboxExtension) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			log.Printf("Skipping outbox entry %v, unable to read it: %v\n", file.Name(), err)
+			continue
+		}
+
+		entry := &OutboxEntry{}
+		if err = json.Unmarshal(data, entry); err != nil {
+			log.Printf("Skipping outbox entry %v, unable to decode it: %v\n", file.Name(), err)
+			continue
+		}
+
+		// the name is what the entry is updated and removed by
+		if entry.ID+OutboxExtension != file.Name() {
+			log.Printf("Skipping outbox entry %v, it holds entry %v\n", file.Name(), entry.ID)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].QueuedAt.Before(entries[j].QueuedAt)
+	})
+
+	return entries, nil
+}
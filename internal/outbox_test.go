@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour},
+		{100, 6 * time.Hour},
+	}
+
+	for _, test := range tests {
+		if got := OutboxBackoff(test.attempts); got != test.want {
+			t.Errorf("OutboxBackoff(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestOutboxEntrySchedule(t *testing.T) {
+	queued := time.Date(2021, 10, 14, 9, 0, 0, 0, time.UTC)
+	entry := &OutboxEntry{ID: "b592ec70-welcome", QueuedAt: queued}
+
+	entry.Failed(errors.New("connection refused"), queued)
+	entry.Failed(errors.New("connection refused"), queued.Add(time.Minute))
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		due     bool
+		expired bool
+	}{
+		{"during the backoff", queued.Add(2 * time.Minute), false, false},
+		{"after the backoff", queued.Add(3 * time.Minute), true, false},
+		{"at the maximum age", queued.Add(OutboxMaxAge), true, false},
+		{"past the maximum age", queued.Add(OutboxMaxAge + time.Second), true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := entry.Due(test.at); got != test.due {
+				t.Errorf("Due = %v, want %v", got, test.due)
+			}
+			if got := entry.Expired(test.at, OutboxMaxAge); got != test.expired {
+				t.Errorf("Expired = %v, want %v", got, test.expired)
+			}
+		})
+	}
+
+	if entry.Attempts != 2 || entry.LastError != "connection refused" {
+		t.Errorf("got %d attempts and error %q", entry.Attempts, entry.LastError)
+	}
+	if entry.Expired(queued.Add(365*24*time.Hour), 0) {
+		t.Errorf("entries never expire without a maximum age")
+	}
+}
+
+func TestListOutbox(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2021, 10, 14, 9, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"newer", "older"} {
+		entry := &OutboxEntry{ID: id, QueuedAt: now.Add(-time.Duration(i) * time.Hour), Message: Message{Kind: "welcome", To: []string{"a@example.com"}}}
+		if err := SaveOutboxEntry(dir, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		"truncated.json": `{"id": "truncated", "queuedAt": `,
+		"renamed.json":   `{"id": "other"}`,
+		"notes.txt":      "not an entry",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lock, err := LockOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ListOutbox(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	if len(ids) != 2 || ids[0] != "older" || ids[1] != "newer" {
+		t.Errorf("got entries %v, want [older newer]", ids)
+	}
+
+	if err = ExpireOutboxEntry(dir, entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ = ListOutbox(dir); len(entries) != 1 || entries[0].ID != "newer" {
+		t.Errorf("expired entry is still listed")
+	}
+	if _, err = os.Stat(filepath.Join(dir, outboxExpiredDir, "older.json")); err != nil {
+		t.Errorf("expired entry was not kept: %v", err)
+	}
+
+	if err = lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, err = ListOutbox(filepath.Join(dir, "missing")); err != nil || entries != nil {
+		t.Errorf("got %v, %v for a missing outbox", entries, err)
+	}
+}
+
+func TestLockOutbox(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := LockOutbox(dir)
+	if err != nil {
+		t.Fatalf("unable to lock: %v", err)
+	}
+
+	if _, err = LockOutbox(dir); err == nil {
+		t.Errorf("expected a second lock to fail")
+	}
+
+	// a lock that was not refreshed for long is taken over
+	stale := time.Now().Add(-outboxLockStale - time.Minute)
+	if err = os.Chtimes(filepath.Join(dir, outboxLockFile), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	other, err := LockOutbox(dir)
+	if err != nil {
+		t.Fatalf("unable to take over a stale lock: %v", err)
+	}
+
+	// the flush whose lock was taken over must not release the lock of the other one
+	if err = lock.Unlock(); err != nil {
+		t.Errorf("unlocking a lock that was taken over: %v", err)
+	}
+	if _, err = LockOutbox(dir); err == nil {
+		t.Errorf("expected the lock taken over to still be held")
+	}
+
+	if err = other.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lock, err = LockOutbox(dir); err != nil {
+		t.Errorf("unable to lock again after unlocking: %v", err)
+	} else if err = lock.Refresh(); err != nil {
+		t.Errorf("unable to refresh: %v", err)
+	}
+}
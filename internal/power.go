@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// WakeUntilAnnotation records when a temporarily woken cluster goes back to sleep
+	WakeUntilAnnotation = "opl-wake-until"
+
+	// HibernateAfterAnnotation keeps the HibernateAfter value a cluster had before a temporary wake
+	HibernateAfterAnnotation = "opl-hibernate-after"
+)
+
+// SetTemporaryWake sets the cluster to Running and uses Hive's HibernateAfter so it hibernates again
+// once duration has passed. It returns the time the cluster is due to sleep.
+func SetTemporaryWake(cd *hivev1.ClusterDeployment, duration time.Duration) time.Time {
+	if cd.Annotations == nil {
+		cd.Annotations = map[string]string{}
+	}
+
+	// only remember the regular value the first time so extending a temporary wake does not lose it
+	if _, ok := cd.Annotations[WakeUntilAnnotation]; !ok {
+		previous := ""
+		if cd.Spec.HibernateAfter != nil {
+			previous = cd.Spec.HibernateAfter.Duration.String()
+		}
+		cd.Annotations[HibernateAfterAnnotation] = previous
+	}
+
+	now := time.Now().UTC()
+	until := now.Add(duration)
+
+	// HibernateAfter counts from the moment the cluster last came out of hibernation
+	cd.Spec.HibernateAfter = &metav1.Duration{Duration: until.Sub(runningSince(cd, now)).Round(time.Second)}
+	cd.Spec.PowerState = hivev1.RunningClusterPowerState
+	cd.Annotations[WakeUntilAnnotation] = until.Format(time.RFC3339)
+
+	return until
+}
+
+// ClearTemporaryWake puts back the HibernateAfter value a cluster had before a temporary wake
+func ClearTemporaryWake(cd *hivev1.ClusterDeployment) {
+	if _, ok := cd.Annotations[WakeUntilAnnotation]; !ok {
+		return
+	}
+
+	cd.Spec.HibernateAfter = nil
+	if previous := cd.Annotations[HibernateAfterAnnotation]; previous != "" {
+		if dur, err := time.ParseDuration(previous); err == nil {
+			cd.Spec.HibernateAfter = &metav1.Duration{Duration: dur}
+		}
+	}
+
+	delete(cd.Annotations, WakeUntilAnnotation)
+	delete(cd.Annotations, HibernateAfterAnnotation)
+}
+
+// ExpireTemporaryWake puts back the regular HibernateAfter value once the temporary wake of the cluster
+// is over, so a later resume does not hibernate it again after the temporary duration. It returns
+// whether the cluster was changed.
+func ExpireTemporaryWake(cd *hivev1.ClusterDeployment, now time.Time) bool {
+	until, ok := TemporaryWakeDeadline(cd)
+	if !ok || now.Before(until) {
+		return false
+	}
+
+	ClearTemporaryWake(cd)
+
+	return true
+}
+
+// TemporaryWakeDeadline returns when a temporarily woken cluster is due to hibernate again
+func TemporaryWakeDeadline(cd *hivev1.ClusterDeployment) (time.Time, bool) {
+	until, ok := cd.Annotations[WakeUntilAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	deadline, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return deadline, true
+}
+
+// runningSince returns when the cluster last came out of hibernation, or now if it is still asleep
+func runningSince(cd *hivev1.ClusterDeployment, now time.Time) time.Time {
+	for _, condition := range cd.Status.Conditions {
+		if condition.Type == hivev1.ClusterHibernatingCondition {
+			if condition.Status == corev1.ConditionFalse && !condition.LastTransitionTime.IsZero() {
+				return condition.LastTransitionTime.UTC()
+			}
+			return now
+		}
+	}
+
+	if cd.Status.InstalledTimestamp != nil {
+		return cd.Status.InstalledTimestamp.UTC()
+	}
+
+	return now
+}
+
+// HiveRunning reports whether Hive finished resuming the cluster and reports it as Running
+func HiveRunning(cd *hivev1.ClusterDeployment) bool {
+	for _, condition := range cd.Status.Conditions {
+		if condition.Type == hivev1.ClusterHibernatingCondition {
+			return condition.Status == corev1.ConditionFalse && condition.Reason == hivev1.RunningHibernationReason
+		}
+	}
+
+	// clusters that never hibernated have no condition
+	return cd.Spec.PowerState != hivev1.HibernatingClusterPowerState
+}
+
+// HibernatingSince returns when the cluster went into hibernation, if it is hibernating
+func HibernatingSince(cd *hivev1.ClusterDeployment) (time.Time, bool) {
+	for _, condition := range cd.Status.Conditions {
+		if condition.Type == hivev1.ClusterHibernatingCondition && condition.Status == corev1.ConditionTrue {
+			return condition.LastTransitionTime.UTC(), true
+		}
+	}
+
+	return time.Time{}, false
+}
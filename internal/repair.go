@@ -0,0 +1,264 @@
+package internal
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// certificateNotAfterAnnotation is where OpenShift's operators record when a certificate expires
+	certificateNotAfterAnnotation = "auth.openshift.io/certificate-not-after"
+
+	nodeUserPrefix = "system:node:"
+	nodesGroup     = "system:nodes"
+
+	// nodeBootstrapper is the service account kubelets use to ask for their first client certificate
+	nodeBootstrapper      = "system:serviceaccount:openshift-machine-config-operator:node-bootstrapper"
+	nodeBootstrapperGroup = "system:serviceaccounts:openshift-machine-config-operator"
+)
+
+// nodeSigners are the signers of the certificates kubelets request for themselves
+var nodeSigners = map[string]bool{
+	certificatesv1.KubeAPIServerClientKubeletSignerName: true,
+	certificatesv1.KubeletServingSignerName:             true,
+}
+
+// internalCertificates are the secrets of the cluster's internal certificates that stop nodes from
+// rejoining when they expire while the cluster is hibernating
+var internalCertificates = []struct{ Namespace, Name string }{
+	{"openshift-kube-apiserver-operator", "kube-apiserver-to-kubelet-signer"},
+	{"openshift-kube-apiserver", "kubelet-client"},
+	{"openshift-kube-controller-manager-operator", "csr-signer-signer"},
+	{"openshift-kube-controller-manager", "csr-signer"},
+}
+
+// CertificateExpiry is when one of the cluster's internal certificates expires
+type CertificateExpiry struct {
+	Secret   string
+	NotAfter time.Time
+}
+
+// CertificateExpiries returns the expiry of the cluster's internal certificates, soonest first.
+// Secrets that do not exist or carry no expiry are left out.
+func CertificateExpiries(ctx context.Context, spoke *kubernetes.Clientset) ([]CertificateExpiry, error) {
+	var expiries []CertificateExpiry
+
+	for _, certificate := range internalCertificates {
+		secret, err := spoke.CoreV1().Secrets(certificate.Namespace).Get(ctx, certificate.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to get secret %v/%v: %w", certificate.Namespace, certificate.Name, err)
+		}
+
+		notafter, err := time.Parse(time.RFC3339, secret.Annotations[certificateNotAfterAnnotation])
+		if err != nil {
+			continue
+		}
+
+		expiries = append(expiries, CertificateExpiry{Secret: certificate.Namespace + "/" + certificate.Name, NotAfter: notafter.UTC()})
+	}
+
+	sort.Slice(expiries, func(i, j int) bool { return expiries[i].NotAfter.Before(expiries[j].NotAfter) })
+
+	return expiries, nil
+}
+
+// ApproveNodeCSRs approves the pending certificate signing requests kubelets made for nodes the cluster
+// knows about and returns their names. Like the machine-approver, a request is only approved when it
+// was made by the node itself, or by the node-bootstrapper for a first client certificate, and asks
+// for nothing but that node's identity and addresses. Any other request is left alone.
+func ApproveNodeCSRs(ctx context.Context, spoke *kubernetes.Clientset) ([]string, error) {
+	nodes, err := spoke.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list nodes: %w", err)
+	}
+
+	known := make(map[string]*corev1.Node)
+	for i := range nodes.Items {
+		known[nodes.Items[i].Name] = &nodes.Items[i]
+	}
+
+	csrs, err := spoke.CertificatesV1().CertificateSigningRequests().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list certificate signing requests: %w", err)
+	}
+
+	var approved []string
+	for i := range csrs.Items {
+		csr := &csrs.Items[i]
+		if !CSRPending(csr) || !nodeSigners[csr.Spec.SignerName] {
+			continue
+		}
+
+		request, err := parseCSR(csr)
+		if err != nil {
+			continue
+		}
+
+		node, ok := known[strings.TrimPrefix(request.Subject.CommonName, nodeUserPrefix)]
+		if !ok || authorizeNodeCSR(csr, request, node) != nil {
+			continue
+		}
+
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:           certificatesv1.CertificateApproved,
+			Status:         corev1.ConditionTrue,
+			Reason:         "OplmgrRepair",
+			Message:        "Approved by oplmgr wake --repair for node " + node.Name,
+			LastUpdateTime: metav1.Now(),
+		})
+
+		if _, err = spoke.CertificatesV1().CertificateSigningRequests().UpdateApproval(ctx, csr.Name, csr, metav1.UpdateOptions{}); err != nil {
+			return approved, fmt.Errorf("unable to approve certificate signing request %v: %w", csr.Name, err)
+		}
+		approved = append(approved, csr.Name)
+	}
+
+	return approved, nil
+}
+
+// parseCSR returns the x509 request of a certificate signing request
+func parseCSR(csr *certificatesv1.CertificateSigningRequest) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csr.Spec.Request)
+	if block == nil {
+		return nil, fmt.Errorf("certificate signing request %v holds no PEM data", csr.Name)
+	}
+
+	request, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse certificate signing request %v: %w", csr.Name, err)
+	}
+
+	return request, nil
+}
+
+// authorizeNodeCSR returns why a kubelet certificate signing request must not be approved for node.
+// The subject must be system:node:<name> in the system:nodes organization. A client certificate must
+// be requested by the node itself or by the node-bootstrapper and carry no SANs; a serving certificate
+// must be requested by the node itself and only name the addresses the node reports.
+func authorizeNodeCSR(csr *certificatesv1.CertificateSigningRequest, request *x509.CertificateRequest, node *corev1.Node) error {
+	nodeuser := nodeUserPrefix + node.Name
+
+	if request.Subject.CommonName != nodeuser {
+		return fmt.Errorf("common name %q is not %v", request.Subject.CommonName, nodeuser)
+	}
+
+	if len(request.Subject.Organization) != 1 || request.Subject.Organization[0] != nodesGroup {
+		return fmt.Errorf("organization %v is not %v", request.Subject.Organization, nodesGroup)
+	}
+
+	if len(request.EmailAddresses) > 0 || len(request.URIs) > 0 {
+		return fmt.Errorf("email and URI SANs are not allowed")
+	}
+
+	self := csr.Spec.Username == nodeuser && Contains(csr.Spec.Groups, nodesGroup)
+
+	switch csr.Spec.SignerName {
+	case certificatesv1.KubeAPIServerClientKubeletSignerName:
+		bootstrap := csr.Spec.Username == nodeBootstrapper && Contains(csr.Spec.Groups, nodeBootstrapperGroup)
+		if !self && !bootstrap {
+			return fmt.Errorf("requested by %v, not by the node or the node-bootstrapper", csr.Spec.Username)
+		}
+		if len(request.DNSNames) > 0 || len(request.IPAddresses) > 0 {
+			return fmt.Errorf("client certificates carry no DNS or IP SANs")
+		}
+		return checkUsages(csr.Spec.Usages, certificatesv1.UsageClientAuth, certificatesv1.UsageServerAuth)
+
+	case certificatesv1.KubeletServingSignerName:
+		if !self {
+			return fmt.Errorf("requested by %v, not by the node", csr.Spec.Username)
+		}
+
+		addresses := make(map[string]bool)
+		for _, address := range node.Status.Addresses {
+			addresses[address.Address] = true
+		}
+		for _, name := range request.DNSNames {
+			if !addresses[name] {
+				return fmt.Errorf("DNS name %v is not an address of node %v", name, node.Name)
+			}
+		}
+		for _, ip := range request.IPAddresses {
+			if !addresses[ip.String()] {
+				return fmt.Errorf("IP address %v is not an address of node %v", ip, node.Name)
+			}
+		}
+		return checkUsages(csr.Spec.Usages, certificatesv1.UsageServerAuth, certificatesv1.UsageClientAuth)
+	}
+
+	return fmt.Errorf("signer %v is not a kubelet signer", csr.Spec.SignerName)
+}
+
+// checkUsages returns an error unless the usages include required and leave out forbidden
+func checkUsages(usages []certificatesv1.KeyUsage, required certificatesv1.KeyUsage, forbidden certificatesv1.KeyUsage) error {
+	found := false
+	for _, usage := range usages {
+		switch usage {
+		case required:
+			found = true
+		case forbidden:
+			return fmt.Errorf("usage %v is not allowed", usage)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("usage %v is missing", required)
+	}
+
+	return nil
+}
+
+// RepairNodes approves node certificate signing requests until every node is Ready or the timeout
+// passes. Kubelets ask for a serving certificate only once their client certificate is approved, so
+// requests are approved again on every round. It returns the requests it approved.
+func RepairNodes(ctx context.Context, spoke *kubernetes.Clientset, timeout time.Duration, interval time.Duration) ([]string, error) {
+	deadline := time.Now().Add(timeout)
+	var approved []string
+
+	for {
+		names, err := ApproveNodeCSRs(ctx, spoke)
+		approved = append(approved, names...)
+		if err != nil {
+			return approved, err
+		}
+
+		nodes, err := spoke.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return approved, fmt.Errorf("unable to list nodes: %w", err)
+		}
+
+		var notready []string
+		for i := range nodes.Items {
+			if !NodeReady(&nodes.Items[i]) {
+				notready = append(notready, nodes.Items[i].Name)
+			}
+		}
+
+		if len(notready) == 0 {
+			return approved, nil
+		}
+
+		if time.Now().After(deadline) {
+			return approved, fmt.Errorf("nodes still not ready after %v: %v", timeout, strings.Join(notready, ", "))
+		}
+
+		select {
+		case <-ctx.Done():
+			return approved, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
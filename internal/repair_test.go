@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+
+	certificatesv1 "k8s.io/api/certificates/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAuthorizeNodeCSR(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-0"},
+		Status: corev1.NodeStatus{Addresses: []corev1.NodeAddress{
+			{Type: corev1.NodeInternalIP, Address: "10.0.0.5"},
+			{Type: corev1.NodeHostName, Address: "worker-0"},
+		}},
+	}
+
+	client := certificatesv1.KubeAPIServerClientKubeletSignerName
+	serving := certificatesv1.KubeletServingSignerName
+	clientusages := []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageClientAuth}
+	servingusages := []certificatesv1.KeyUsage{certificatesv1.UsageDigitalSignature, certificatesv1.UsageServerAuth}
+	nodegroups := []string{"system:nodes", "system:authenticated"}
+	bootstrapgroups := []string{"system:serviceaccounts", nodeBootstrapperGroup}
+
+	tests := []struct {
+		name         string
+		signer       string
+		username     string
+		groups       []string
+		usages       []certificatesv1.KeyUsage
+		cn           string
+		organization []string
+		dns          []string
+		ips          []string
+		ok           bool
+	}{
+		{"client renewal by the node", client, "system:node:worker-0", nodegroups, clientusages, "system:node:worker-0", []string{"system:nodes"}, nil, nil, true},
+		{"client bootstrap", client, nodeBootstrapper, bootstrapgroups, clientusages, "system:node:worker-0", []string{"system:nodes"}, nil, nil, true},
+		{"client by another user", client, "developer", []string{"system:authenticated"}, clientusages, "system:node:worker-0", []string{"system:nodes"}, nil, nil, false},
+		{"client by another node", client, "system:node:worker-1", nodegroups, clientusages, "system:node:worker-0", []string{"system:nodes"}, nil, nil, false},
+		{"client with SANs", client, "system:node:worker-0", nodegroups, clientusages, "system:node:worker-0", []string{"system:nodes"}, []string{"worker-0"}, nil, false},
+		{"client asking for server auth", client, "system:node:worker-0", nodegroups, append(clientusages, certificatesv1.UsageServerAuth), "system:node:worker-0", []string{"system:nodes"}, nil, nil, false},
+		{"wrong organization", client, "system:node:worker-0", nodegroups, clientusages, "system:node:worker-0", []string{"system:masters"}, nil, nil, false},
+		{"serving with node addresses", serving, "system:node:worker-0", nodegroups, servingusages, "system:node:worker-0", []string{"system:nodes"}, []string{"worker-0"}, []string{"10.0.0.5"}, true},
+		{"serving by the bootstrapper", serving, nodeBootstrapper, bootstrapgroups, servingusages, "system:node:worker-0", []string{"system:nodes"}, nil, []string{"10.0.0.5"}, false},
+		{"serving with a foreign DNS name", serving, "system:node:worker-0", nodegroups, servingusages, "system:node:worker-0", []string{"system:nodes"}, []string{"api.example.com"}, nil, false},
+		{"serving with a foreign IP", serving, "system:node:worker-0", nodegroups, servingusages, "system:node:worker-0", []string{"system:nodes"}, nil, []string{"10.0.0.6"}, false},
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template := &x509.CertificateRequest{
+				Subject:  pkix.Name{CommonName: test.cn, Organization: test.organization},
+				DNSNames: test.dns,
+			}
+			for _, ip := range test.ips {
+				template.IPAddresses = append(template.IPAddresses, net.ParseIP(ip))
+			}
+
+			der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request, err := x509.ParseCertificateRequest(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			csr := &certificatesv1.CertificateSigningRequest{Spec: certificatesv1.CertificateSigningRequestSpec{
+				SignerName: test.signer,
+				Username:   test.username,
+				Groups:     test.groups,
+				Usages:     test.usages,
+			}}
+
+			err = authorizeNodeCSR(csr, request, node)
+			if test.ok && err != nil {
+				t.Errorf("expected the request to be approved, got %v", err)
+			}
+			if !test.ok && err == nil {
+				t.Errorf("expected the request to be refused")
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	netmail "net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/envy"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// SMTP encryption modes
+const (
+	EncryptionNone     = "none"
+	EncryptionSTARTTLS = "starttls"
+	EncryptionTLS      = "tls"
+)
+
+// SMTP authentication mechanisms
+const (
+	AuthNone    = "none"
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+)
+
+// SMTPSettings maps the names of the SMTP settings, also used as keys of the config file, to the
+// environment variables they are read from
+var SMTPSettings = map[string]string{
+	"host":            "SMTP_HOST",
+	"port":            "SMTP_PORT",
+	"encryption":      "SMTP_ENCRYPTION",
+	"auth":            "SMTP_AUTH",
+	"username":        "SMTP_USER",
+	"password":        "SMTP_PASSWORD",
+	"ca-file":         "SMTP_CA_FILE",
+	"connect-timeout": "SMTP_CONNECT_TIMEOUT",
+	"send-timeout":    "SMTP_SEND_TIMEOUT",
+	"from":            "SMTP_FROM",
+	"reply-to":        "SMTP_REPLY_TO",
+}
+
+// smtpEnvironment returns the SMTP settings set in the environment
+func smtpEnvironment() map[string]string {
+	settings := map[string]string{}
+	for name, variable := range SMTPSettings {
+		if value := envy.Get(variable, ""); value != "" {
+			settings[name] = value
+		}
+	}
+
+	return settings
+}
+
+// Configure applies SMTP settings given by name, e.g. "port" or "encryption", and checks them. Settings
+// that are left out keep their current value.
+func (m *Mailer) Configure(settings map[string]string) error {
+	for name, value := range settings {
+		var err error
+
+		switch name {
+		case "host":
+			m.Host = value
+		case "port":
+			if m.Port, err = strconv.Atoi(value); err == nil && (m.Port < 0 || m.Port > 65535) {
+				err = fmt.Errorf("out of range")
+			}
+		case "encryption":
+			m.Encryption = strings.ToLower(value)
+			_, err = smtpEncryption(m.Encryption)
+		case "auth":
+			m.Auth = strings.ToLower(value)
+			_, err = smtpAuth(m.Auth)
+		case "username":
+			m.Username = value
+		case "password":
+			m.Password = value
+		case "ca-file":
+			m.CAFile = value
+			_, err = m.tlsConfig()
+		case "connect-timeout":
+			m.ConnectTimeout, err = time.ParseDuration(value)
+		case "send-timeout":
+			m.SendTimeout, err = time.ParseDuration(value)
+		case "from":
+			m.From = value
+			_, err = netmail.ParseAddress(value)
+		case "reply-to":
+			m.ReplyTo = value
+			if value != "" {
+				_, err = netmail.ParseAddress(value)
+			}
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid SMTP %v %q: %w", name, value, err)
+		}
+	}
+
+	return nil
+}
+
+// SMTPPort returns the port connected to; the usual port of the encryption mode unless one is set
+func (m *Mailer) SMTPPort() int {
+	if m.Port != 0 {
+		return m.Port
+	}
+
+	switch m.Encryption {
+	case EncryptionNone:
+		return 25
+	case EncryptionTLS:
+		return 465
+	}
+
+	return 587
+}
+
+// Connect opens a connection to the SMTP server, authenticating unless the auth mechanism is none.
+// The caller closes the client.
+func (m *Mailer) Connect() (*mail.SMTPClient, error) {
+	encryption, err := smtpEncryption(m.Encryption)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP encryption %q: %w", m.Encryption, err)
+	}
+
+	auth, err := smtpAuth(m.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP auth %q: %w", m.Auth, err)
+	}
+
+	tlsconfig, err := m.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	server := mail.NewSMTPClient()
+	server.Host = m.Host
+	server.Port = m.SMTPPort()
+	server.Username = m.Username
+	server.Password = m.Password
+	server.Encryption = encryption
+	server.Authentication = auth
+	server.TLSConfig = tlsconfig
+	server.KeepAlive = false
+	server.ConnectTimeout = m.ConnectTimeout
+	server.SendTimeout = m.SendTimeout
+
+	client, err := server.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %v:%v: %w", m.Host, server.Port, err)
+	}
+
+	return client, nil
+}
+
+// tlsConfig trusts the certificates of CAFile on top of the system ones; it is nil without a CAFile
+func (m *Mailer) tlsConfig() (*tls.Config, error) {
+	if m.CAFile == "" {
+		return nil, nil
+	}
+
+	pem, err := os.ReadFile(m.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the SMTP CA file: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %v", m.CAFile)
+	}
+
+	return &tls.Config{ServerName: m.Host, RootCAs: pool}, nil
+}
+
+func smtpEncryption(mode string) (mail.Encryption, error) {
+	switch mode {
+	case EncryptionNone:
+		return mail.EncryptionNone, nil
+	case EncryptionSTARTTLS, "":
+		return mail.EncryptionSTARTTLS, nil
+	case EncryptionTLS, "ssl":
+		return mail.EncryptionSSLTLS, nil
+	}
+
+	return mail.EncryptionNone, fmt.Errorf("use none, starttls or tls")
+}
+
+func smtpAuth(mechanism string) (mail.AuthType, error) {
+	switch mechanism {
+	case AuthNone:
+		return mail.AuthNone, nil
+	case AuthPlain, "":
+		return mail.AuthPlain, nil
+	case AuthLogin:
+		return mail.AuthLogin, nil
+	case AuthCRAMMD5:
+		return mail.AuthCRAMMD5, nil
+	}
+
+	return mail.AuthNone, fmt.Errorf("use none, plain, login or cram-md5")
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"strconv"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+)
+
+const (
+	// PendingDeletionLabel marks a soft deleted lab; its value is the unix time of the soft delete
+	PendingDeletionLabel = "opl-pending-deletion"
+
+	// DeleteAtAnnotation records when a soft deleted lab is due to be deleted for real
+	DeleteAtAnnotation = "opl-delete-at"
+
+	// PowerStateAnnotation keeps the power state a lab had before it was soft deleted
+	PowerStateAnnotation = "opl-power-state"
+)
+
+// SoftDelete hibernates the cluster and marks it as pending deletion until grace has passed. It
+// returns the time the cluster is due to be deleted.
+func SoftDelete(cd *hivev1.ClusterDeployment, grace time.Duration, now time.Time) time.Time {
+	if cd.Labels == nil {
+		cd.Labels = map[string]string{}
+	}
+	if cd.Annotations == nil {
+		cd.Annotations = map[string]string{}
+	}
+
+	ClearTemporaryWake(cd)
+
+	deleteat := now.UTC().Add(grace)
+
+	cd.Annotations[PowerStateAnnotation] = string(cd.Spec.PowerState)
+	cd.Annotations[DeleteAtAnnotation] = deleteat.Format(time.RFC3339)
+	cd.Labels[PendingDeletionLabel] = strconv.FormatInt(now.Unix(), 10)
+	cd.Spec.PowerState = hivev1.HibernatingClusterPowerState
+
+	return deleteat
+}
+
+// Restore undoes SoftDelete and puts back the power state the cluster had before
+func Restore(cd *hivev1.ClusterDeployment) {
+	cd.Spec.PowerState = hivev1.ClusterPowerState(cd.Annotations[PowerStateAnnotation])
+
+	delete(cd.Labels, PendingDeletionLabel)
+	delete(cd.Annotations, DeleteAtAnnotation)
+	delete(cd.Annotations, PowerStateAnnotation)
+}
+
+// PendingDeletion reports whether the cluster was soft deleted and when it is due to be deleted
+func PendingDeletion(cd *hivev1.ClusterDeployment) (time.Time, bool) {
+	since, ok := cd.Labels[PendingDeletionLabel]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if deleteat, err := time.Parse(time.RFC3339, cd.Annotations[DeleteAtAnnotation]); err == nil {
+		return deleteat, true
+	}
+
+	// without the annotation the cluster is due as soon as it was soft deleted
+	unix, err := strconv.ParseInt(since, 10, 64)
+	if err != nil {
+		return time.Time{}, true
+	}
+
+	return time.Unix(unix, 0).UTC(), true
+}
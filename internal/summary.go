@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"strconv"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// InstallStatusInstalled is reported once Hive finished installing the cluster
+	InstallStatusInstalled = "Installed"
+
+	// InstallStatusInstalling is reported while Hive is still trying to install the cluster
+	InstallStatusInstalling = "Installing"
+
+	// InstallStatusFailed is reported once Hive gave up installing the cluster
+	InstallStatusFailed = "Failed"
+)
+
+// healthyWhenTrue are the conditions that report a problem when they are False; every other
+// condition reports a problem when it is True
+var healthyWhenTrue = map[string]bool{
+	string(hivev1.RequirementsMetCondition):                                true,
+	string(hivev1.AWSPrivateLinkReadyClusterDeploymentCondition):           true,
+	string(hivev1.ClusterInstallCompletedClusterDeploymentCondition):       true,
+	string(hivev1.ClusterInstallRequirementsMetClusterDeploymentCondition): true,
+	string(hivev1.ClusterProvisionInitializedCondition):                    true,
+	string(hivev1.ClusterProvisionCompletedCondition):                      true,
+	string(hivev1.ClusterProvisionJobCreated):                              true,
+}
+
+// informationalConditions describe the cluster without saying anything about its health
+var informationalConditions = map[string]bool{
+	string(hivev1.ClusterHibernatingCondition):   true,
+	string(hivev1.ActiveAPIURLOverrideCondition): true,
+}
+
+// ConditionSummary is a condition of the ClusterDeployment or its ClusterProvision that reports a problem
+type ConditionSummary struct {
+	Type    string    `json:"type"`
+	Reason  string    `json:"reason,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// ClusterSummary is what info reports about a single cluster
+type ClusterSummary struct {
+	ClusterID         string             `json:"clusterID"`
+	ClusterName       string             `json:"clusterName"`
+	Company           string             `json:"company,omitempty"`
+	Sponsor           string             `json:"sponsor,omitempty"`
+	Region            string             `json:"region,omitempty"`
+	Platform          string             `json:"platform,omitempty"`
+	PowerState        string             `json:"powerState"`
+	InstallStatus     string             `json:"installStatus"`
+	ProvisionStage    string             `json:"provisionStage,omitempty"`
+	ProvisionAttempts int                `json:"provisionAttempts,omitempty"`
+	InstallRestarts   int                `json:"installRestarts,omitempty"`
+	Conditions        []ConditionSummary `json:"conditions,omitempty"`
+	LastError         string             `json:"lastError,omitempty"`
+	HibernatesAt      *time.Time         `json:"hibernatesAt,omitempty"`
+	PendingDeletionAt *time.Time         `json:"pendingDeletionAt,omitempty"`
+	ConsoleURL        string             `json:"consoleURL,omitempty"`
+	RequestURL        string             `json:"requestURL,omitempty"`
+	Created           time.Time          `json:"created"`
+	LeaseEnd          *time.Time         `json:"leaseEnd,omitempty"`
+	SecretRefs        map[string]string  `json:"secretRefs,omitempty"`
+	Credentials       map[string]string  `json:"credentials,omitempty"`
+	Health            *HealthReport      `json:"health,omitempty"`
+	Error             string             `json:"error,omitempty"`
+}
+
+// NewClusterSummary summarises what the ClusterDeployment itself knows about the cluster
+func NewClusterSummary(cd *hivev1.ClusterDeployment) ClusterSummary {
+	summary := ClusterSummary{
+		ClusterID:   cd.Name,
+		ClusterName: cd.Spec.ClusterName,
+		Company:     cd.Annotations[CompanyAnnotation],
+		Sponsor:     cd.Annotations[SponsorAnnotation],
+		Region:      LabRegion(cd),
+		Platform:    PlatformName(cd),
+		PowerState:  string(cd.Spec.PowerState),
+		ConsoleURL:  cd.Status.WebConsoleURL,
+		Created:     cd.CreationTimestamp.UTC(),
+	}
+
+	// Hive treats an unset powerState as Running
+	if summary.PowerState == "" {
+		summary.PowerState = string(hivev1.RunningClusterPowerState)
+	}
+
+	if until, ok := TemporaryWakeDeadline(cd); ok && until.After(time.Now()) {
+		summary.HibernatesAt = &until
+	}
+
+	if deleteat, ok := PendingDeletion(cd); ok {
+		summary.PendingDeletionAt = &deleteat
+	}
+
+	if leaseend, ok := LeaseEnd(cd); ok {
+		summary.LeaseEnd = &leaseend
+	}
+
+	summary.InstallRestarts = cd.Status.InstallRestarts
+	summary.InstallStatus = InstallStatusInstalling
+
+	for _, condition := range cd.Status.Conditions {
+		summary.addCondition(string(condition.Type), condition.Status, condition.Reason, condition.Message, condition.LastTransitionTime.Time)
+
+		if condition.Type == hivev1.ProvisionStoppedCondition && condition.Status == corev1.ConditionTrue {
+			summary.InstallStatus = InstallStatusFailed
+		}
+	}
+
+	if cd.Spec.Installed {
+		summary.InstallStatus = InstallStatusInstalled
+	}
+
+	return summary
+}
+
+// SetProvision adds the stage, attempt and problems of the cluster's latest ClusterProvision
+func (s *ClusterSummary) SetProvision(provision *hivev1.ClusterProvision) {
+	s.ProvisionStage = string(provision.Spec.Stage)
+	s.ProvisionAttempts = provision.Spec.Attempt + 1
+
+	for _, condition := range provision.Status.Conditions {
+		s.addCondition(string(condition.Type), condition.Status, condition.Reason, condition.Message, condition.LastTransitionTime.Time)
+	}
+}
+
+// addCondition keeps the condition when it reports a problem; the message of the most recent
+// problem becomes the last error
+func (s *ClusterSummary) addCondition(kind string, status corev1.ConditionStatus, reason string, message string, since time.Time) {
+	if informationalConditions[kind] || status == corev1.ConditionUnknown {
+		return
+	}
+
+	if (status == corev1.ConditionTrue) == healthyWhenTrue[kind] {
+		return
+	}
+
+	s.Conditions = append(s.Conditions, ConditionSummary{Type: kind, Reason: reason, Message: message, Since: since.UTC()})
+
+	latest := time.Time{}
+	for _, condition := range s.Conditions {
+		if condition.Message != "" && !condition.Since.Before(latest) {
+			latest = condition.Since
+			s.LastError = condition.Message
+		}
+	}
+}
+
+// Install describes how far the installation got, e.g. Installing (provisioning, attempt 2)
+func (s ClusterSummary) Install() string {
+	if s.InstallStatus == InstallStatusInstalled || s.ProvisionStage == "" {
+		return s.InstallStatus
+	}
+
+	return s.InstallStatus + " (" + s.ProvisionStage + ", attempt " + strconv.Itoa(s.ProvisionAttempts) + ")"
+}
+
+// AdminSecretRefs returns the names of the secrets holding the kubeadmin password and the kubeconfig
+func AdminSecretRefs(cd *hivev1.ClusterDeployment) map[string]string {
+	if cd.Spec.ClusterMetadata == nil {
+		return nil
+	}
+
+	return map[string]string{
+		"kubeadmin":  cd.Spec.ClusterMetadata.AdminPasswordSecretRef.Name,
+		"kubeconfig": cd.Spec.ClusterMetadata.AdminKubeconfigSecretRef.Name,
+	}
+}
+
+// State describes the power state for people, or the install status of clusters not installed yet; when a temporary wake ends or a soft delete is due
+func (s ClusterSummary) State() string {
+	switch {
+	case s.PendingDeletionAt != nil:
+		return "Pending deletion at " + s.PendingDeletionAt.Format(time.RFC3339)
+	case s.InstallStatus != InstallStatusInstalled:
+		return s.InstallStatus
+	case s.HibernatesAt != nil:
+		return s.PowerState + " (hibernates again at " + s.HibernatesAt.Format(time.RFC3339) + ")"
+	}
+
+	return s.PowerState
+}
+
+// PlatformName returns the cloud and region the cluster runs in, e.g. aws/us-west-2
+func PlatformName(cd *hivev1.ClusterDeployment) string {
+	platform := cd.Spec.Platform
+
+	switch {
+	case platform.AWS != nil:
+		return "aws/" + platform.AWS.Region
+	case platform.Azure != nil:
+		return "azure/" + platform.Azure.Region
+	case platform.GCP != nil:
+		return "gcp/" + platform.GCP.Region
+	case platform.OpenStack != nil:
+		return "openstack/" + platform.OpenStack.Cloud
+	case platform.VSphere != nil:
+		return "vsphere/" + platform.VSphere.Datacenter
+	case platform.Ovirt != nil:
+		return "ovirt/" + platform.Ovirt.ClusterID
+	case platform.BareMetal != nil:
+		return "baremetal"
+	}
+
+	return ""
+}
@@ -0,0 +1,235 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+	"github.com/openshift/hive/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	runtimec "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OwnerLabel marks every object oplmgr creates for a lab with the name of the lab's ClusterDeployment
+const OwnerLabel = "opl-lab"
+
+// DeprovisionSecrets returns the secrets Hive needs to remove the cloud resources of the cluster
+func DeprovisionSecrets(cd *hivev1.ClusterDeployment) []string {
+	var secrets []string
+
+	platform := cd.Spec.Platform
+	switch {
+	case platform.AWS != nil:
+		secrets = append(secrets, platform.AWS.CredentialsSecretRef.Name)
+	case platform.Azure != nil:
+		secrets = append(secrets, platform.Azure.CredentialsSecretRef.Name)
+	case platform.GCP != nil:
+		secrets = append(secrets, platform.GCP.CredentialsSecretRef.Name)
+	case platform.OpenStack != nil:
+		secrets = append(secrets, platform.OpenStack.CredentialsSecretRef.Name)
+		if platform.OpenStack.CertificatesSecretRef != nil {
+			secrets = append(secrets, platform.OpenStack.CertificatesSecretRef.Name)
+		}
+	case platform.VSphere != nil:
+		secrets = append(secrets, platform.VSphere.CredentialsSecretRef.Name, platform.VSphere.CertificatesSecretRef.Name)
+	case platform.Ovirt != nil:
+		secrets = append(secrets, platform.Ovirt.CredentialsSecretRef.Name, platform.Ovirt.CertificatesSecretRef.Name)
+	}
+
+	return secrets
+}
+
+// DeleteLabResources deletes the objects labelled as belonging to the lab; MachinePools, SyncSets,
+// the ClusterImageSet, ConfigMaps and Secrets. Secrets named in keep are left alone.
+func DeleteLabResources(hiveclient runtimec.Client, k8sclient *kubernetes.Clientset, namespace string, name string, keep []string) error {
+	ctx := context.Background()
+	owned := runtimec.MatchingLabels{OwnerLabel: name}
+	selector := metav1.ListOptions{LabelSelector: OwnerLabel + "=" + name}
+	failed := 0
+
+	deleted := func(kind string, objname string, err error) {
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("Unable to delete %v %v: %v\n", kind, objname, err)
+			failed++
+			return
+		}
+		log.Printf("Deleted %v %v\n", kind, objname)
+	}
+
+	machinepools := hivev1.MachinePoolList{}
+	if err := hiveclient.List(ctx, &machinepools, runtimec.InNamespace(namespace), owned); err != nil {
+		return fmt.Errorf("unable to list machine pools: %w", err)
+	}
+	for i := range machinepools.Items {
+		deleted("MachinePool", machinepools.Items[i].Name, hiveclient.Delete(ctx, &machinepools.Items[i]))
+	}
+
+	syncsets := hivev1.SyncSetList{}
+	if err := hiveclient.List(ctx, &syncsets, runtimec.InNamespace(namespace), owned); err != nil {
+		return fmt.Errorf("unable to list syncsets: %w", err)
+	}
+	for i := range syncsets.Items {
+		deleted("SyncSet", syncsets.Items[i].Name, hiveclient.Delete(ctx, &syncsets.Items[i]))
+	}
+
+	imagesets := hivev1.ClusterImageSetList{}
+	if err := hiveclient.List(ctx, &imagesets, owned); err != nil {
+		return fmt.Errorf("unable to list cluster image sets: %w", err)
+	}
+	for i := range imagesets.Items {
+		deleted("ClusterImageSet", imagesets.Items[i].Name, hiveclient.Delete(ctx, &imagesets.Items[i]))
+	}
+
+	configmaps, err := k8sclient.CoreV1().ConfigMaps(namespace).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("unable to list config maps: %w", err)
+	}
+	for _, configmap := range configmaps.Items {
+		deleted("ConfigMap", configmap.Name, k8sclient.CoreV1().ConfigMaps(namespace).Delete(ctx, configmap.Name, metav1.DeleteOptions{}))
+	}
+
+	secrets, err := k8sclient.CoreV1().Secrets(namespace).List(ctx, selector)
+	if err != nil {
+		return fmt.Errorf("unable to list secrets: %w", err)
+	}
+	for _, secret := range secrets.Items {
+		if Contains(keep, secret.Name) {
+			log.Printf("Keeping Secret %v until the cluster is deprovisioned; the next delete or reap removes it\n", secret.Name)
+			continue
+		}
+		deleted("Secret", secret.Name, k8sclient.CoreV1().Secrets(namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{}))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to delete %d resources of lab %v", failed, name)
+	}
+
+	return nil
+}
+
+// orphanMinAge keeps the sweep away from the secrets of a lab that is still being provisioned, which
+// are created just before its ClusterDeployment
+const orphanMinAge = time.Hour
+
+// DeleteOrphanedLabSecrets deletes the secrets labelled as belonging to a lab whose ClusterDeployment
+// is gone. These are the cloud credentials kept for Hive to deprovision the cluster when it was
+// deleted without waiting. Only the secrets that would be deleted are logged when dryrun is set.
+func DeleteOrphanedLabSecrets(hiveclient runtimec.Client, k8sclient *kubernetes.Clientset, namespace string, dryrun bool) error {
+	ctx := context.Background()
+
+	secrets, err := k8sclient.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: OwnerLabel})
+	if err != nil {
+		return fmt.Errorf("unable to list lab secrets: %w", err)
+	}
+
+	failed := 0
+	exists := map[string]bool{}
+
+	for _, secret := range secrets.Items {
+		name := secret.Labels[OwnerLabel]
+		if time.Since(secret.CreationTimestamp.Time) < orphanMinAge {
+			continue
+		}
+
+		if _, checked := exists[name]; !checked {
+			cd := hivev1.ClusterDeployment{}
+			err := hiveclient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &cd)
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("unable to get cluster deployment %v: %w", name, err)
+			}
+			exists[name] = err == nil
+		}
+
+		if exists[name] {
+			continue
+		}
+
+		if dryrun {
+			log.Printf("Would delete Secret %v of deleted lab %v\n", secret.Name, name)
+			continue
+		}
+
+		err := k8sclient.CoreV1().Secrets(namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("Unable to delete Secret %v of deleted lab %v: %v\n", secret.Name, name, err)
+			failed++
+			continue
+		}
+		log.Printf("Deleted Secret %v of deleted lab %v\n", secret.Name, name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to delete %d secrets of deleted labs", failed)
+	}
+
+	return nil
+}
+
+// DeprovisionStatus describes how far Hive got removing the cloud resources of a deleted cluster
+// and reports done once the ClusterDeployment is gone
+func DeprovisionStatus(hiveclient runtimec.Client, k8sclient *kubernetes.Clientset, namespace string, name string) (string, bool, error) {
+	ctx := context.Background()
+	nsn := types.NamespacedName{Namespace: namespace, Name: name}
+
+	cd := hivev1.ClusterDeployment{}
+	if err := hiveclient.Get(ctx, nsn, &cd); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "deprovision complete", true, nil
+		}
+		return "", false, err
+	}
+
+	var status []string
+
+	for _, condition := range cd.Status.Conditions {
+		if condition.Type == hivev1.DeprovisionLaunchErrorCondition && condition.Status == corev1.ConditionTrue {
+			status = append(status, fmt.Sprintf("deprovision launch error %v: %v", condition.Reason, condition.Message))
+		}
+	}
+
+	cdr := hivev1.ClusterDeprovision{}
+	if err := hiveclient.Get(ctx, nsn, &cdr); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", false, err
+		}
+		status = append(status, "waiting for the ClusterDeprovision to be created")
+	} else if cdr.Status.Completed {
+		status = append(status, "cloud resources removed, waiting for Hive to finish")
+	} else {
+		status = append(status, "removing cloud resources")
+		for _, condition := range cdr.Status.Conditions {
+			if condition.Status == corev1.ConditionTrue {
+				status = append(status, fmt.Sprintf("%v %v: %v", condition.Type, condition.Reason, condition.Message))
+			}
+		}
+	}
+
+	pods, err := k8sclient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: constants.ClusterDeprovisionNameLabel + "=" + name,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	for _, pod := range pods.Items {
+		podstatus := fmt.Sprintf("uninstall pod %v %v", pod.Name, pod.Status.Phase)
+		for _, container := range pod.Status.ContainerStatuses {
+			if container.State.Waiting != nil {
+				podstatus += " (" + container.State.Waiting.Reason + ")"
+			}
+			if container.RestartCount > 0 {
+				podstatus += fmt.Sprintf(" restarted %d times", container.RestartCount)
+			}
+		}
+		status = append(status, podstatus)
+	}
+
+	return strings.Join(status, "; "), false, nil
+}
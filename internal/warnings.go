@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	hivev1 "github.com/openshift/hive/apis/hive/v1"
+)
+
+const (
+	// WarningsSentAnnotation keeps the warnings already sent to the contacts of a cluster
+	WarningsSentAnnotation = "opl-warnings-sent"
+
+	// HibernationWarning is sent ahead of the daily hibernation
+	HibernationWarning = "hibernate"
+
+	// DeletionWarning is sent ahead of the end of the lease
+	DeletionWarning = "delete"
+)
+
+// DueWarnings returns the keys of every warning of the given kind whose lead time before deadline has
+// been reached at t. Nothing is due once the deadline has passed.
+func DueWarnings(kind string, deadline time.Time, t time.Time, leads []time.Duration) []string {
+	var keys []string
+
+	if !t.Before(deadline) {
+		return keys
+	}
+
+	sorted := append([]time.Duration{}, leads...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for _, lead := range sorted {
+		if !t.Before(deadline.Add(-lead)) {
+			keys = append(keys, kind+"/"+deadline.UTC().Format(time.RFC3339)+"/"+lead.String())
+		}
+	}
+
+	return keys
+}
+
+// WarningSent reports whether the warning with the given key was recorded on the cluster
+func WarningSent(cd *hivev1.ClusterDeployment, key string) bool {
+	return Contains(sentWarnings(cd), key)
+}
+
+// RecordWarnings marks the warnings as sent. Warnings of the same kind recorded for an earlier
+// deadline are dropped so the annotation does not grow every day.
+func RecordWarnings(cd *hivev1.ClusterDeployment, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	deadline := keys[0][:strings.LastIndex(keys[0], "/")+1]
+	kind := deadline[:strings.Index(deadline, "/")+1]
+
+	var sent []string
+	for _, key := range sentWarnings(cd) {
+		if strings.HasPrefix(key, kind) && !strings.HasPrefix(key, deadline) {
+			continue
+		}
+		sent = append(sent, key)
+	}
+
+	for _, key := range keys {
+		if !Contains(sent, key) {
+			sent = append(sent, key)
+		}
+	}
+
+	if cd.Annotations == nil {
+		cd.Annotations = map[string]string{}
+	}
+	cd.Annotations[WarningsSentAnnotation] = strings.Join(sent, ",")
+}
+
+func sentWarnings(cd *hivev1.ClusterDeployment) []string {
+	sent := cd.Annotations[WarningsSentAnnotation]
+	if sent == "" {
+		return nil
+	}
+
+	return strings.Split(sent, ",")
+}